@@ -4,12 +4,19 @@ package edgee
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -19,6 +26,14 @@ const (
 	APIEndpoint = "/v1/chat/completions"
 )
 
+// ErrEmptyStream is reported when a stream ends without any content and
+// Config.TreatEmptyStreamAsError is set
+var ErrEmptyStream = errors.New("stream ended without any content")
+
+// ErrStoppedByPredicate is reported when a stream is stopped by the
+// predicate given to WithStopPredicate
+var ErrStoppedByPredicate = errors.New("stream stopped by predicate")
+
 // Message represents a chat message
 type Message struct {
 	Role       string     `json:"role"`
@@ -26,6 +41,35 @@ type Message struct {
 	Name       *string    `json:"name,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID *string    `json:"tool_call_id,omitempty"`
+
+	// ReasoningContent holds the reasoning emitted by reasoning models; it is
+	// never sent in requests
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// Annotation represents a citation attached to a message by models using
+// web or file search
+type Annotation struct {
+	Type         string        `json:"type"` // "url_citation" or "file_citation"
+	URLCitation  *URLCitation  `json:"url_citation,omitempty"`
+	FileCitation *FileCitation `json:"file_citation,omitempty"`
+}
+
+// URLCitation cites a web page for the content between StartIndex and EndIndex
+type URLCitation struct {
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+}
+
+// FileCitation cites an uploaded file
+type FileCitation struct {
+	FileID   string `json:"file_id"`
+	Filename string `json:"filename,omitempty"`
+	Quote    string `json:"quote,omitempty"`
 }
 
 // ToolCall represents a function call request from the model
@@ -33,6 +77,10 @@ type ToolCall struct {
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
+
+	// Index identifies the tool call a streaming delta belongs to; it is
+	// never sent in requests
+	Index *int `json:"index,omitempty"`
 }
 
 // FunctionCall represents the function name and arguments
@@ -52,6 +100,197 @@ type FunctionDefinition struct {
 	Name        string         `json:"name"`
 	Description *string        `json:"description,omitempty"`
 	Parameters  map[string]any `json:"parameters,omitempty"`
+
+	// Strict asks the provider to enforce exact adherence to Parameters
+	Strict *bool `json:"strict,omitempty"`
+}
+
+// jsonSchemaTypes lists the primitive types allowed in a JSON Schema "type"
+var jsonSchemaTypes = map[string]bool{
+	"string":  true,
+	"number":  true,
+	"integer": true,
+	"boolean": true,
+	"array":   true,
+	"object":  true,
+	"null":    true,
+}
+
+// ValidateSchema checks that Parameters is a structurally valid JSON Schema
+// object: "type" is "object", every property is a schema with valid types,
+// and "required" is an array of strings naming declared properties
+func (f *FunctionDefinition) ValidateSchema() error {
+	if f.Parameters == nil {
+		return nil
+	}
+
+	// Normalize Go literals (e.g. []string, map[string]string) to their JSON form
+	paramBytes, err := json.Marshal(f.Parameters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal parameters for %s: %w", f.Name, err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(paramBytes, &schema); err != nil {
+		return fmt.Errorf("failed to unmarshal parameters for %s: %w", f.Name, err)
+	}
+
+	if schema["type"] != "object" {
+		return fmt.Errorf("invalid parameters for %s: type must be \"object\", got %v", f.Name, schema["type"])
+	}
+	if err := validateSchemaNode(schema, "parameters"); err != nil {
+		return fmt.Errorf("invalid parameters for %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// Clone returns a deep copy of f whose Parameters can be changed, e.g. with
+// WithRequired, without affecting f
+func (f *FunctionDefinition) Clone() *FunctionDefinition {
+	clone := *f
+	if f.Description != nil {
+		description := *f.Description
+		clone.Description = &description
+	}
+	if f.Strict != nil {
+		strict := *f.Strict
+		clone.Strict = &strict
+	}
+	if f.Parameters != nil {
+		clone.Parameters = copySchemaValue(f.Parameters).(map[string]any)
+	}
+	return &clone
+}
+
+// WithRequired replaces the required parameters of f with names, which must
+// all be declared in Parameters' "properties". Combine it with Clone to
+// require different parameters for one request. It returns f for chaining.
+func (f *FunctionDefinition) WithRequired(names ...string) (*FunctionDefinition, error) {
+	if f.Parameters == nil {
+		return nil, fmt.Errorf("invalid required parameters for %s: no parameters defined", f.Name)
+	}
+
+	// Normalize Go literals (e.g. map[string]map[string]any) to their JSON form
+	propBytes, err := json.Marshal(f.Parameters["properties"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal properties for %s: %w", f.Name, err)
+	}
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(propBytes, &properties); err != nil {
+		return nil, fmt.Errorf("invalid properties for %s: %w", f.Name, err)
+	}
+	for _, name := range names {
+		if _, ok := properties[name]; !ok {
+			return nil, fmt.Errorf("invalid required parameters for %s: unknown property %q", f.Name, name)
+		}
+	}
+
+	if len(names) == 0 {
+		delete(f.Parameters, "required")
+	} else {
+		f.Parameters["required"] = append([]string(nil), names...)
+	}
+	return f, nil
+}
+
+// copySchemaValue deep-copies the maps and slices of a JSON Schema value
+func copySchemaValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, item := range v {
+			copied[key] = copySchemaValue(item)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = copySchemaValue(item)
+		}
+		return copied
+	case map[string]string:
+		copied := make(map[string]string, len(v))
+		for key, item := range v {
+			copied[key] = item
+		}
+		return copied
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
+
+func validateSchemaNode(node map[string]any, path string) error {
+	if t, ok := node["type"]; ok {
+		if err := validateSchemaType(t, path); err != nil {
+			return err
+		}
+	}
+
+	properties := map[string]any{}
+	if p, ok := node["properties"]; ok {
+		props, ok := p.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s.properties must be an object", path)
+		}
+		for name, prop := range props {
+			propSchema, ok := prop.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s.properties.%s must be an object", path, name)
+			}
+			if err := validateSchemaNode(propSchema, path+".properties."+name); err != nil {
+				return err
+			}
+		}
+		properties = props
+	}
+
+	if r, ok := node["required"]; ok {
+		required, ok := r.([]any)
+		if !ok {
+			return fmt.Errorf("%s.required must be an array", path)
+		}
+		for _, item := range required {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%s.required must contain only strings, got %v", path, item)
+			}
+			if _, ok := properties[name]; !ok {
+				return fmt.Errorf("%s.required references unknown property %q", path, name)
+			}
+		}
+	}
+
+	if i, ok := node["items"]; ok {
+		items, ok := i.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s.items must be an object", path)
+		}
+		if err := validateSchemaNode(items, path+".items"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateSchemaType(t any, path string) error {
+	switch v := t.(type) {
+	case string:
+		if !jsonSchemaTypes[v] {
+			return fmt.Errorf("%s.type %q is not a valid JSON Schema type", path, v)
+		}
+	case []any:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok || !jsonSchemaTypes[s] {
+				return fmt.Errorf("%s.type %v is not a valid JSON Schema type", path, item)
+			}
+		}
+	default:
+		return fmt.Errorf("%s.type must be a string or an array of strings", path)
+	}
+	return nil
 }
 
 // InputObject represents structured input for chat completion
@@ -60,6 +299,75 @@ type InputObject struct {
 	Tools      []Tool    `json:"tools,omitempty"`
 	ToolChoice any       `json:"tool_choice,omitempty"` // string or object
 	Tags       []string  `json:"tags,omitempty"`
+
+	// Metadata is attached to the request for routing and tagging; the
+	// gateway echoes it back in SendResponse.Metadata
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	ResponseFormat any `json:"response_format,omitempty"` // e.g. {"type": "json_schema", ...}
+
+	// Provider safety settings, e.g. Mistral's safe_prompt
+	SafePrompt *bool `json:"safe_prompt,omitempty"`
+	Safety     any   `json:"safety,omitempty"` // provider-specific passthrough
+
+	Temperature      *float64 `json:"temperature,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+
+	// Extra holds additional top-level request parameters (e.g. min_p, top_a)
+	// sent as-is; typed fields that are set take precedence on key collision
+	Extra map[string]any `json:"-"`
+}
+
+// validRoles lists the message roles accepted by InputObjectFromMaps
+var validRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// InputObjectFromMaps converts OpenAI-style message maps (role, content,
+// name, tool_calls, tool_call_id) into an InputObject, validating roles
+func InputObjectFromMaps(messages []map[string]any) (InputObject, error) {
+	input := InputObject{Messages: make([]Message, 0, len(messages))}
+
+	for i, m := range messages {
+		role, _ := m["role"].(string)
+		if !validRoles[role] {
+			return InputObject{}, fmt.Errorf("message %d: invalid role %q", i, m["role"])
+		}
+		msg := Message{Role: role}
+
+		if content, ok := m["content"]; ok && content != nil {
+			s, ok := content.(string)
+			if !ok {
+				return InputObject{}, fmt.Errorf("message %d: content must be a string, got %T", i, content)
+			}
+			msg.Content = s
+		}
+		if name, ok := m["name"].(string); ok {
+			msg.Name = &name
+		}
+		if toolCallID, ok := m["tool_call_id"].(string); ok {
+			msg.ToolCallID = &toolCallID
+		}
+		if err := decodeMapField(m, "tool_calls", &msg.ToolCalls); err != nil {
+			return InputObject{}, fmt.Errorf("message %d: %w", i, err)
+		}
+
+		if role == "tool" && msg.ToolCallID == nil {
+			return InputObject{}, fmt.Errorf("message %d: tool message requires tool_call_id", i)
+		}
+		if len(msg.ToolCalls) > 0 && role != "assistant" {
+			return InputObject{}, fmt.Errorf("message %d: tool_calls are only allowed on assistant messages", i)
+		}
+
+		input.Messages = append(input.Messages, msg)
+	}
+
+	return input, nil
 }
 
 // Request represents the request body for chat completions
@@ -70,13 +378,120 @@ type Request struct {
 	Tools      []Tool    `json:"tools,omitempty"`
 	ToolChoice any       `json:"tool_choice,omitempty"`
 	Tags       []string  `json:"tags,omitempty"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	ResponseFormat any `json:"response_format,omitempty"`
+
+	SafePrompt *bool `json:"safe_prompt,omitempty"`
+	Safety     any   `json:"safety,omitempty"`
+
+	Temperature      *float64 `json:"temperature,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+
+	Extra map[string]any `json:"-"`
+}
+
+// MarshalJSON merges Extra into the top-level request object. Typed fields
+// that are set take precedence over Extra entries with the same key.
+// Response-only message fields are dropped so that messages taken from a
+// response can be sent back as conversation history.
+func (r Request) MarshalJSON() ([]byte, error) {
+	type request Request // avoids recursing into MarshalJSON
+	r.Messages = outgoingMessages(r.Messages)
+	body, err := json.Marshal(request(r))
+	if err != nil || len(r.Extra) == 0 {
+		return body, err
+	}
+
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(body, &typed); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]any, len(r.Extra)+len(typed))
+	for key, value := range r.Extra {
+		merged[key] = value
+	}
+	for key, value := range typed {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+// outgoingMessages returns a copy of messages without the fields providers
+// only emit in responses, leaving the caller's messages untouched
+func outgoingMessages(messages []Message) []Message {
+	if messages == nil {
+		return nil
+	}
+	out := make([]Message, len(messages))
+	for i, msg := range messages {
+		msg.ReasoningContent = ""
+		msg.Annotations = nil
+		if msg.ToolCalls != nil {
+			msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+			for j := range msg.ToolCalls {
+				msg.ToolCalls[j].Index = nil
+			}
+		}
+		out[i] = msg
+	}
+	return out
+}
+
+// requestKeys lists the JSON keys of the typed Request fields; any other
+// top-level key is decoded into Extra
+var requestKeys = map[string]bool{
+	"model":             true,
+	"messages":          true,
+	"stream":            true,
+	"tools":             true,
+	"tool_choice":       true,
+	"tags":              true,
+	"metadata":          true,
+	"response_format":   true,
+	"safe_prompt":       true,
+	"safety":            true,
+	"temperature":       true,
+	"frequency_penalty": true,
+	"presence_penalty":  true,
+}
+
+// UnmarshalJSON decodes a request body, collecting top-level keys that have
+// no typed field into Extra so that a logged request can be replayed as-is
+func (r *Request) UnmarshalJSON(data []byte) error {
+	type request Request // avoids recursing into UnmarshalJSON
+	var typed request
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		if requestKeys[key] {
+			continue
+		}
+		if typed.Extra == nil {
+			typed.Extra = map[string]any{}
+		}
+		typed.Extra[key] = value
+	}
+
+	*r = Request(typed)
+	return nil
 }
 
 // StreamDelta represents a streaming chunk delta
 type StreamDelta struct {
-	Role      *string    `json:"role,omitempty"`
-	Content   *string    `json:"content,omitempty"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role             *string    `json:"role,omitempty"`
+	Content          *string    `json:"content,omitempty"`
+	ReasoningContent *string    `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 }
 
 // Choice represents a choice in the response
@@ -100,6 +515,55 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// RateLimit represents the rate-limit state reported by the gateway
+type RateLimit struct {
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// parseRateLimit reads the x-ratelimit-* headers, returning nil if none are set.
+// Malformed values are left at zero.
+func parseRateLimit(h http.Header) *RateLimit {
+	var rl RateLimit
+	found := false
+
+	parseInt := func(name string, dst *int) {
+		if v := h.Get(name); v != "" {
+			found = true
+			if n, err := strconv.Atoi(v); err == nil {
+				*dst = n
+			}
+		}
+	}
+	parseReset := func(name string, dst *time.Duration) {
+		if v := h.Get(name); v != "" {
+			found = true
+			if d, err := time.ParseDuration(v); err == nil {
+				*dst = d
+			} else if secs, err := strconv.ParseFloat(v, 64); err == nil {
+				// Plain numbers are seconds
+				*dst = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+
+	parseInt("x-ratelimit-limit-requests", &rl.LimitRequests)
+	parseInt("x-ratelimit-remaining-requests", &rl.RemainingRequests)
+	parseReset("x-ratelimit-reset-requests", &rl.ResetRequests)
+	parseInt("x-ratelimit-limit-tokens", &rl.LimitTokens)
+	parseInt("x-ratelimit-remaining-tokens", &rl.RemainingTokens)
+	parseReset("x-ratelimit-reset-tokens", &rl.ResetTokens)
+
+	if !found {
+		return nil
+	}
+	return &rl
+}
+
 // SendResponse represents the response from a non-streaming request
 type SendResponse struct {
 	ID      string   `json:"id"`
@@ -108,6 +572,16 @@ type SendResponse struct {
 	Model   string   `json:"model"`
 	Choices []Choice `json:"choices"`
 	Usage   *Usage   `json:"usage,omitempty"`
+
+	// Metadata is the request metadata echoed back by the gateway, if any
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// RateLimit is parsed from the x-ratelimit-* response headers, if present
+	RateLimit *RateLimit `json:"-"`
+
+	// Request is a copy of the request body that was sent, populated only
+	// when Config.IncludeRequest is set
+	Request *Request `json:"-"`
 }
 
 // Text returns the text content from the first choice (convenience method)
@@ -118,6 +592,14 @@ func (r *SendResponse) Text() string {
 	return ""
 }
 
+// Reasoning returns the reasoning content from the first choice (convenience method)
+func (r *SendResponse) Reasoning() string {
+	if len(r.Choices) > 0 && r.Choices[0].Message != nil {
+		return r.Choices[0].Message.ReasoningContent
+	}
+	return ""
+}
+
 // MessageContent returns the message from the first choice (convenience method)
 func (r *SendResponse) MessageContent() *Message {
 	if len(r.Choices) > 0 {
@@ -142,6 +624,14 @@ func (r *SendResponse) ToolCalls() []ToolCall {
 	return nil
 }
 
+// Annotations returns the annotations from the first choice (convenience method)
+func (r *SendResponse) Annotations() []Annotation {
+	if len(r.Choices) > 0 && r.Choices[0].Message != nil {
+		return r.Choices[0].Message.Annotations
+	}
+	return nil
+}
+
 // StreamChunk represents a streaming response chunk
 type StreamChunk struct {
 	ID      string         `json:"id"`
@@ -149,6 +639,7 @@ type StreamChunk struct {
 	Created int64          `json:"created"`
 	Model   string         `json:"model"`
 	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage,omitempty"`
 }
 
 // Text returns the text content from the first choice (convenience method)
@@ -159,6 +650,14 @@ func (c *StreamChunk) Text() string {
 	return ""
 }
 
+// Reasoning returns the reasoning content from the first choice (convenience method)
+func (c *StreamChunk) Reasoning() string {
+	if len(c.Choices) > 0 && c.Choices[0].Delta != nil && c.Choices[0].Delta.ReasoningContent != nil {
+		return *c.Choices[0].Delta.ReasoningContent
+	}
+	return ""
+}
+
 // Role returns the role from the first choice (convenience method)
 func (c *StreamChunk) Role() string {
 	if len(c.Choices) > 0 && c.Choices[0].Delta != nil && c.Choices[0].Delta.Role != nil {
@@ -175,16 +674,77 @@ func (c *StreamChunk) FinishReason() string {
 	return ""
 }
 
+// isEmpty reports whether the chunk carries no usage, and no text, reasoning,
+// tool calls or finish reason in any choice (e.g. a role-only or empty delta)
+func (c *StreamChunk) isEmpty() bool {
+	if c.Usage != nil {
+		return false
+	}
+	for _, choice := range c.Choices {
+		if choice.FinishReason != nil {
+			return false
+		}
+		if d := choice.Delta; d != nil && ((d.Content != nil && *d.Content != "") ||
+			(d.ReasoningContent != nil && *d.ReasoningContent != "") || len(d.ToolCalls) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
 // Config represents configuration for the Edgee client
 type Config struct {
 	APIKey  string
 	BaseURL string
+
+	// DefaultModel is used when Send or Stream is called with an empty model
+	DefaultModel string
+
+	// Timeout bounds each non-streaming request. For streams it bounds only
+	// the wait for the response headers, so a generation may keep streaming
+	// past it. Zero means no timeout.
+	Timeout time.Duration
+
+	// IncludeRequest attaches the request that was sent to each SendResponse
+	IncludeRequest bool
+
+	// SuppressEmptyChunks skips streaming chunks that carry no text, tool
+	// calls or finish reason, such as role-only deltas
+	SuppressEmptyChunks bool
+
+	// TreatEmptyStreamAsError makes streams that end without any text, tool
+	// calls, finish reason or usage (e.g. only [DONE]) report ErrEmptyStream
+	TreatEmptyStreamAsError bool
+
+	// UsageTracker, if set, accumulates the usage of every request
+	UsageTracker *UsageTracker
+
+	// StreamFallback retries a streaming request without streaming when the
+	// model rejects streaming, emitting the full response as a single chunk.
+	// That chunk is handled, and recorded by StreamRecord, like a streamed one.
+	StreamFallback bool
+
+	// Sampling defaults applied to requests whose input does not set them
+	DefaultTemperature      *float64
+	DefaultFrequencyPenalty *float64
+	DefaultPresencePenalty  *float64
 }
 
 // Client represents an Edgee AI Gateway client
 type Client struct {
-	apiKey  string
-	baseURL string
+	apiKey                  string
+	baseURL                 string
+	defaultModel            string
+	timeout                 time.Duration
+	includeRequest          bool
+	suppressEmptyChunks     bool
+	streamFallback          bool
+	treatEmptyStreamAsError bool
+	usageTracker            *UsageTracker
+
+	defaultTemperature      *float64
+	defaultFrequencyPenalty *float64
+	defaultPresencePenalty  *float64
 }
 
 // NewClient creates a new Edgee client with flexible configuration:
@@ -192,7 +752,11 @@ type Client struct {
 // - Pass a *Config to set both API key and base URL
 // - Pass nil to use environment variables (EDGEE_API_KEY, EDGEE_BASE_URL)
 func NewClient(config any) (*Client, error) {
-	var apiKey, baseURL string
+	var apiKey, baseURL, defaultModel string
+	var timeout time.Duration
+	var usageTracker *UsageTracker
+	var includeRequest, suppressEmptyChunks, streamFallback, treatEmptyStreamAsError bool
+	var defaultTemperature, defaultFrequencyPenalty, defaultPresencePenalty *float64
 
 	switch v := config.(type) {
 	case string:
@@ -202,6 +766,16 @@ func NewClient(config any) (*Client, error) {
 		// Config struct
 		apiKey = v.APIKey
 		baseURL = v.BaseURL
+		defaultModel = v.DefaultModel
+		timeout = v.Timeout
+		includeRequest = v.IncludeRequest
+		suppressEmptyChunks = v.SuppressEmptyChunks
+		streamFallback = v.StreamFallback
+		treatEmptyStreamAsError = v.TreatEmptyStreamAsError
+		usageTracker = v.UsageTracker
+		defaultTemperature = v.DefaultTemperature
+		defaultFrequencyPenalty = v.DefaultFrequencyPenalty
+		defaultPresencePenalty = v.DefaultPresencePenalty
 	case nil:
 		// Use environment variables
 		apiKey = os.Getenv("EDGEE_API_KEY")
@@ -229,27 +803,186 @@ func NewClient(config any) (*Client, error) {
 	}
 
 	return &Client{
-		apiKey:  apiKey,
-		baseURL: baseURL,
+		apiKey:                  apiKey,
+		baseURL:                 baseURL,
+		defaultModel:            defaultModel,
+		timeout:                 timeout,
+		includeRequest:          includeRequest,
+		suppressEmptyChunks:     suppressEmptyChunks,
+		streamFallback:          streamFallback,
+		treatEmptyStreamAsError: treatEmptyStreamAsError,
+		usageTracker:            usageTracker,
+
+		defaultTemperature:      defaultTemperature,
+		defaultFrequencyPenalty: defaultFrequencyPenalty,
+		defaultPresencePenalty:  defaultPresencePenalty,
 	}, nil
 }
 
+// requestOptions holds per-request settings resolved from RequestOptions
+type requestOptions struct {
+	baseURL  string
+	recorder io.Writer
+
+	safePrompt *bool
+	safety     any
+
+	stopPredicate func(accumulated string) bool
+}
+
+// RequestOption customizes a single request
+type RequestOption func(*requestOptions)
+
+// WithBaseURL overrides the client's base URL for a single request
+func WithBaseURL(baseURL string) RequestOption {
+	return func(o *requestOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithSafePrompt sets the provider safe_prompt flag for a single request
+func WithSafePrompt(enabled bool) RequestOption {
+	return func(o *requestOptions) {
+		o.safePrompt = &enabled
+	}
+}
+
+// WithSafety sets provider-specific safety settings for a single request
+func WithSafety(settings any) RequestOption {
+	return func(o *requestOptions) {
+		o.safety = settings
+	}
+}
+
+// WithStopPredicate evaluates stop against the text accumulated so far as a
+// stream progresses. When it returns true the stream is closed, the chunk
+// that tripped it is not forwarded and ErrStoppedByPredicate is reported.
+// The single chunk emitted by Config.StreamFallback is checked the same way.
+func WithStopPredicate(stop func(accumulated string) bool) RequestOption {
+	return func(o *requestOptions) {
+		o.stopPredicate = stop
+	}
+}
+
+func (c *Client) resolveOptions(opts []RequestOption) (*requestOptions, error) {
+	o := &requestOptions{baseURL: c.baseURL}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.baseURL != c.baseURL {
+		if err := validateBaseURL(o.baseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// validateBaseURL checks that baseURL is an absolute http(s) URL
+func validateBaseURL(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid base URL %q: must be an absolute http(s) URL", baseURL)
+	}
+	return nil
+}
+
+// fileConfig is the JSON format read by NewClientFromFile
+type fileConfig struct {
+	APIKey       string `json:"api_key"`
+	BaseURL      string `json:"base_url"`
+	DefaultModel string `json:"default_model"`
+	Timeout      string `json:"timeout"` // Go duration, e.g. "30s"
+}
+
+// NewClientFromFile creates a new Edgee client from a JSON config file with
+// "api_key", "base_url", "default_model" and "timeout" keys. Unset values
+// fall back to environment variables and defaults as in NewClient.
+func NewClientFromFile(path string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fc); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if fc.APIKey == "" && os.Getenv("EDGEE_API_KEY") == "" {
+		return nil, fmt.Errorf("invalid config file %s: api_key is required unless EDGEE_API_KEY is set", path)
+	}
+
+	config := &Config{
+		APIKey:       fc.APIKey,
+		BaseURL:      fc.BaseURL,
+		DefaultModel: fc.DefaultModel,
+	}
+	if fc.BaseURL != "" {
+		if err := validateBaseURL(fc.BaseURL); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if fc.Timeout != "" {
+		timeout, err := time.ParseDuration(fc.Timeout)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid config file %s: timeout %q must be a duration such as \"30s\"", path, fc.Timeout)
+		}
+		config.Timeout = timeout
+	}
+
+	client, err := NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return client, nil
+}
+
 // Send sends a chat completion request with flexible input:
 // - Pass a string for simple user input
 // - Pass an InputObject for full control
 // - Pass a map[string]any with "messages", "tools", "tool_choice" keys
-func (c *Client) Send(model string, input any) (response SendResponse, err error) {
-	req, err := c.buildRequest(model, input, false)
+func (c *Client) Send(model string, input any, opts ...RequestOption) (response SendResponse, err error) {
+	o, err := c.resolveOptions(opts)
+	if err != nil {
+		return
+	}
+	req, err := c.buildRequest(model, input, false, o)
+	if err != nil {
+		return
+	}
+	response, err = c.handleNonStreamingResponse(req, o)
 	if err != nil {
 		return
 	}
-	response, err = c.handleNonStreamingResponse(req)
+	if c.includeRequest {
+		response.Request, err = snapshotRequest(req)
+	}
 	return
 }
 
+// snapshotRequest returns a deep copy of req as it is sent on the wire, so
+// the attached request stays unchanged if the caller later edits its input
+func snapshotRequest(req *Request) (*Request, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var snapshot Request
+	if err := json.Unmarshal(body, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	return &snapshot, nil
+}
+
 // ChatCompletion sends a non-streaming chat completion request (convenience method)
-func (c *Client) ChatCompletion(model string, input any) (response SendResponse, err error) {
-	response, err = c.Send(model, input)
+func (c *Client) ChatCompletion(model string, input any, opts ...RequestOption) (response SendResponse, err error) {
+	response, err = c.Send(model, input, opts...)
 	if err != nil {
 		return
 	}
@@ -257,31 +990,60 @@ func (c *Client) ChatCompletion(model string, input any) (response SendResponse,
 }
 
 // Stream sends a streaming chat completion request (convenience method)
-func (c *Client) Stream(model string, input any) (<-chan *StreamChunk, <-chan error) {
-	req, err := c.buildRequest(model, input, true)
+func (c *Client) Stream(model string, input any, opts ...RequestOption) (<-chan *StreamChunk, <-chan error) {
+	o, err := c.resolveOptions(opts)
 	if err != nil {
-		errChan := make(chan error, 1)
-		errChan <- err
-		close(errChan)
-		chunkChan := make(chan *StreamChunk)
-		close(chunkChan)
-		return chunkChan, errChan
+		return failedStream(err)
 	}
 
-	result, err := c.handleStreamingResponse(req)
+	req, err := c.buildRequest(model, input, true, o)
 	if err != nil {
-		errChan := make(chan error, 1)
-		errChan <- err
-		close(errChan)
-		chunkChan := make(chan *StreamChunk)
-		close(chunkChan)
-		return chunkChan, errChan
+		return failedStream(err)
+	}
+
+	result, err := c.handleStreamingResponse(req, o)
+	if err != nil {
+		return failedStream(err)
 	}
 
 	return result.ChunkChan, result.ErrChan
 }
 
-func (c *Client) buildRequest(model string, input any, stream bool) (*Request, error) {
+// failedStream returns closed stream channels carrying only err
+func failedStream(err error) (<-chan *StreamChunk, <-chan error) {
+	errChan := make(chan error, 1)
+	errChan <- err
+	close(errChan)
+	chunkChan := make(chan *StreamChunk)
+	close(chunkChan)
+	return chunkChan, errChan
+}
+
+// StreamJSON sends a streaming chat completion request, accumulates the
+// streamed content and unmarshals it into v once the stream completes.
+// It is intended for use with a JSON response_format.
+func (c *Client) StreamJSON(model string, input any, v any, opts ...RequestOption) error {
+	chunkChan, errChan := c.Stream(model, input, opts...)
+
+	var content strings.Builder
+	for chunk := range chunkChan {
+		content.WriteString(chunk.Text())
+	}
+	if err := <-errChan; err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal([]byte(content.String()), v); err != nil {
+		return fmt.Errorf("failed to unmarshal streamed content: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) buildRequest(model string, input any, stream bool, o *requestOptions) (*Request, error) {
+	if model == "" {
+		model = c.defaultModel
+	}
+
 	req := &Request{
 		Model:  model,
 		Stream: stream,
@@ -296,11 +1058,27 @@ func (c *Client) buildRequest(model string, input any, stream bool) (*Request, e
 		req.Tools = v.Tools
 		req.ToolChoice = v.ToolChoice
 		req.Tags = v.Tags
+		req.Metadata = v.Metadata
+		req.ResponseFormat = v.ResponseFormat
+		req.SafePrompt = v.SafePrompt
+		req.Safety = v.Safety
+		req.Extra = v.Extra
+		req.Temperature = v.Temperature
+		req.FrequencyPenalty = v.FrequencyPenalty
+		req.PresencePenalty = v.PresencePenalty
 	case *InputObject:
 		req.Messages = v.Messages
 		req.Tools = v.Tools
 		req.ToolChoice = v.ToolChoice
 		req.Tags = v.Tags
+		req.Metadata = v.Metadata
+		req.ResponseFormat = v.ResponseFormat
+		req.SafePrompt = v.SafePrompt
+		req.Safety = v.Safety
+		req.Extra = v.Extra
+		req.Temperature = v.Temperature
+		req.FrequencyPenalty = v.FrequencyPenalty
+		req.PresencePenalty = v.PresencePenalty
 	case map[string]any:
 		// Map input
 		if messages, ok := v["messages"]; ok {
@@ -335,20 +1113,80 @@ func (c *Client) buildRequest(model string, input any, stream bool) (*Request, e
 				}
 			}
 		}
+		if err := decodeMapField(v, "metadata", &req.Metadata); err != nil {
+			return nil, err
+		}
+		if responseFormat, ok := v["response_format"]; ok {
+			req.ResponseFormat = responseFormat
+		}
+		if err := decodeMapField(v, "safe_prompt", &req.SafePrompt); err != nil {
+			return nil, err
+		}
+		if safety, ok := v["safety"]; ok {
+			req.Safety = safety
+		}
+		if err := decodeMapField(v, "temperature", &req.Temperature); err != nil {
+			return nil, err
+		}
+		if err := decodeMapField(v, "frequency_penalty", &req.FrequencyPenalty); err != nil {
+			return nil, err
+		}
+		if err := decodeMapField(v, "presence_penalty", &req.PresencePenalty); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, fmt.Errorf("unsupported input type: %T", input)
 	}
 
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("at least one message is required")
+	}
+
+	// Per-request options override the input
+	if o.safePrompt != nil {
+		req.SafePrompt = o.safePrompt
+	}
+	if o.safety != nil {
+		req.Safety = o.safety
+	}
+
+	// Apply client-level sampling defaults the input did not override
+	if req.Temperature == nil {
+		req.Temperature = c.defaultTemperature
+	}
+	if req.FrequencyPenalty == nil {
+		req.FrequencyPenalty = c.defaultFrequencyPenalty
+	}
+	if req.PresencePenalty == nil {
+		req.PresencePenalty = c.defaultPresencePenalty
+	}
+
 	return req, nil
 }
 
-func (c *Client) handleNonStreamingResponse(req *Request) (response SendResponse, err error) {
+// decodeMapField decodes m[key], if present, into dst via a JSON round-trip
+func decodeMapField(m map[string]any, key string, dst any) error {
+	value, ok := m[key]
+	if !ok {
+		return nil
+	}
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", key, err)
+	}
+	if err := json.Unmarshal(valueBytes, dst); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *Client) handleNonStreamingResponse(req *Request, o *requestOptions) (response SendResponse, err error) {
 	body, err := json.Marshal(req)
 	if err != nil {
 		return response, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequest("POST", c.baseURL+APIEndpoint, bytes.NewReader(body))
+	httpReq, err := http.NewRequest("POST", o.baseURL+APIEndpoint, bytes.NewReader(body))
 	if err != nil {
 		return response, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -356,7 +1194,7 @@ func (c *Client) handleNonStreamingResponse(req *Request) (response SendResponse
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: c.timeout}
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		return response, fmt.Errorf("failed to send request: %w", err)
@@ -368,14 +1206,49 @@ func (c *Client) handleNonStreamingResponse(req *Request) (response SendResponse
 		return response, fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	if contentType := resp.Header.Get("Content-Type"); !isJSONContentType(contentType) {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySnippet))
+		return response, fmt.Errorf("unexpected content type %q in successful response: %s", contentType, string(snippet))
+	}
+
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return response, fmt.Errorf("failed to decode response: %w", err)
 	}
+	response.RateLimit = parseRateLimit(resp.Header)
+	c.trackUsage(response.Model, req.Model, response.Usage)
 
 	return
 }
 
-func (c *Client) handleStreamingResponse(req *Request) (struct {
+// trackUsage records usage on the configured UsageTracker, keyed by the model
+// reported by the gateway or, failing that, the requested model
+func (c *Client) trackUsage(model, requestedModel string, usage *Usage) {
+	if c.usageTracker == nil || usage == nil {
+		return
+	}
+	if model == "" {
+		model = requestedModel
+	}
+	c.usageTracker.Add(model, *usage)
+}
+
+// maxBodySnippet bounds how much of an unexpected response body is included in errors
+const maxBodySnippet = 512
+
+// isJSONContentType reports whether a response Content-Type denotes JSON.
+// A missing Content-Type is accepted and left to the decoder.
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (c *Client) handleStreamingResponse(req *Request, o *requestOptions) (struct {
 	ChunkChan <-chan *StreamChunk
 	ErrChan   <-chan error
 }, error) {
@@ -392,7 +1265,10 @@ func (c *Client) handleStreamingResponse(req *Request) (struct {
 			return
 		}
 
-		httpReq, err := http.NewRequest("POST", c.baseURL+APIEndpoint, bytes.NewReader(body))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+APIEndpoint, bytes.NewReader(body))
 		if err != nil {
 			errChan <- fmt.Errorf("failed to create request: %w", err)
 			return
@@ -401,56 +1277,581 @@ func (c *Client) handleStreamingResponse(req *Request) (struct {
 		httpReq.Header.Set("Content-Type", "application/json")
 		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+		// The timeout only covers waiting for the response headers so that
+		// long generations are not cut off mid-stream
+		var timer *time.Timer
+		if c.timeout > 0 {
+			timer = time.AfterFunc(c.timeout, cancel)
+		}
 		client := &http.Client{}
 		resp, err := client.Do(httpReq)
+		if timer != nil && !timer.Stop() {
+			if err == nil {
+				resp.Body.Close()
+			}
+			err = fmt.Errorf("timeout after %s awaiting response headers", c.timeout)
+		}
 		if err != nil {
 			errChan <- fmt.Errorf("failed to send request: %w", err)
 			return
 		}
 		defer resp.Body.Close()
 
+		received := false
+		var accumulated strings.Builder
+		var usage *Usage
+		var model string
+		// handle applies the per-chunk stream handling, shared by SSE chunks
+		// and the single chunk emitted by the non-streaming fallback
+		handle := func(chunk *StreamChunk) error {
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+				model = chunk.Model
+			}
+			if o.stopPredicate != nil {
+				accumulated.WriteString(chunk.Text())
+				if o.stopPredicate(accumulated.String()) {
+					return ErrStoppedByPredicate
+				}
+			}
+			if chunk.isEmpty() {
+				if c.suppressEmptyChunks {
+					return nil
+				}
+			} else {
+				received = true
+			}
+			chunkChan <- chunk
+			return nil
+		}
+
 		if resp.StatusCode != http.StatusOK {
 			bodyBytes, _ := io.ReadAll(resp.Body)
-			errChan <- fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
-			return
-		}
+			if !c.streamFallback || !isStreamingUnsupported(resp.StatusCode, bodyBytes) {
+				errChan <- fmt.Errorf("API error %d: %s", resp.StatusCode, string(bodyBytes))
+				return
+			}
 
-		reader := bufio.NewReader(resp.Body)
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				if err == io.EOF {
+			// Retry without streaming and emit the result as a single chunk;
+			// the non-streaming request already tracks its usage
+			fallbackReq := *req
+			fallbackReq.Stream = false
+			response, fallbackErr := c.handleNonStreamingResponse(&fallbackReq, o)
+			if fallbackErr != nil {
+				errChan <- fallbackErr
+				return
+			}
+			chunk := chunkFromResponse(response)
+			if o.recorder != nil {
+				if err := recordChunk(o.recorder, chunk); err != nil {
+					errChan <- err
 					return
 				}
-				errChan <- fmt.Errorf("error reading stream: %w", err)
-				return
 			}
+			err = handle(chunk)
+		} else {
+			var stream io.Reader = resp.Body
+			if o.recorder != nil {
+				stream = io.TeeReader(resp.Body, o.recorder)
+			}
+			err = readStream(stream, handle)
+			c.trackUsage(model, req.Model, usage)
+		}
+		if err != nil {
+			errChan <- err
+			return
+		}
+		if c.treatEmptyStreamAsError && !received {
+			errChan <- ErrEmptyStream
+		}
+	}()
+
+	return struct {
+		ChunkChan <-chan *StreamChunk
+		ErrChan   <-chan error
+	}{ChunkChan: chunkChan, ErrChan: errChan}, nil
+}
+
+// streamingUnsupportedPhrases are error messages used by providers when a
+// model does not accept stream=true
+var streamingUnsupportedPhrases = []string{
+	"does not support streaming",
+	"does not support stream",
+	"streaming is not supported",
+	"streaming not supported",
+	"stream not supported",
+	"'stream' does not support",
+}
+
+// isStreamingUnsupported reports whether an error response indicates that the
+// model rejected the request because it does not support streaming, either
+// via an OpenAI-style error whose param is "stream" or a known message
+func isStreamingUnsupported(statusCode int, body []byte) bool {
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+	default:
+		return false
+	}
+
+	var apiErr struct {
+		Error struct {
+			Param string `json:"param"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Param == "stream" {
+		return true
+	}
+
+	message := strings.ToLower(string(body))
+	for _, phrase := range streamingUnsupportedPhrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkFromResponse converts a non-streaming response into an equivalent
+// single streaming chunk
+func chunkFromResponse(response SendResponse) *StreamChunk {
+	chunk := &StreamChunk{
+		ID:      response.ID,
+		Object:  "chat.completion.chunk",
+		Created: response.Created,
+		Model:   response.Model,
+		Usage:   response.Usage,
+	}
+	for _, choice := range response.Choices {
+		streamChoice := StreamChoice{
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		}
+		if choice.Message != nil {
+			role := choice.Message.Role
+			content := choice.Message.Content
+			streamChoice.Delta = &StreamDelta{
+				Role:      &role,
+				Content:   &content,
+				ToolCalls: choice.Message.ToolCalls,
+			}
+			if reasoning := choice.Message.ReasoningContent; reasoning != "" {
+				streamChoice.Delta.ReasoningContent = &reasoning
+			}
+		}
+		chunk.Choices = append(chunk.Choices, streamChoice)
+	}
+	return chunk
+}
+
+// recordChunk writes chunk to w as server-sent events followed by [DONE], so
+// that a fallback response replays like a streamed one
+func recordChunk(w io.Writer, chunk *StreamChunk) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data); err != nil {
+		return fmt.Errorf("failed to record chunk: %w", err)
+	}
+	return nil
+}
+
+// readStream parses server-sent events from r and passes each chunk to
+// handle until the stream ends, [DONE] is received or handle returns an error
+func readStream(r io.Reader, handle func(*StreamChunk) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("error reading stream: %w", err)
+		}
+
+		lineStr := strings.TrimSpace(string(line))
+		if lineStr == "" {
+			continue
+		}
+
+		if strings.HasPrefix(lineStr, "data: ") {
+			data := strings.TrimPrefix(lineStr, "data: ")
+
+			if data == "[DONE]" {
+				return nil
+			}
+
+			var chunk StreamChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				// Skip malformed JSON
+				continue
+			}
+
+			if err := handle(&chunk); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamRecord sends a streaming chat completion request like Stream while
+// writing the raw server-sent events to w, e.g. to capture a fixture for
+// ReplayStream. w is written from the streaming goroutine and must not be
+// used until the chunk channel is closed.
+func (c *Client) StreamRecord(model string, input any, w io.Writer, opts ...RequestOption) (<-chan *StreamChunk, <-chan error) {
+	record := func(o *requestOptions) {
+		o.recorder = w
+	}
+	// Copy opts so the caller's backing array is never written to
+	return c.Stream(model, input, append(opts[:len(opts):len(opts)], record)...)
+}
+
+// ReplayStream parses server-sent events recorded by StreamRecord (or any
+// chat completions SSE body), producing the same chunks Stream would
+func ReplayStream(r io.Reader) (<-chan *StreamChunk, <-chan error) {
+	chunkChan := make(chan *StreamChunk, 10)
+	errChan := make(chan error, 1)
+
+	go func() {
+		defer close(chunkChan)
+		defer close(errChan)
+
+		err := readStream(r, func(chunk *StreamChunk) error {
+			chunkChan <- chunk
+			return nil
+		})
+		if err != nil {
+			errChan <- err
+		}
+	}()
+
+	return chunkChan, errChan
+}
+
+// maxStreamChoices bounds the choice indexes StreamCollect accepts (the
+// OpenAI API allows at most 128 choices per request)
+const maxStreamChoices = 128
+
+// StreamCollect drains the channels returned by Stream and assembles the
+// chunks into the SendResponse a non-streaming request would have returned,
+// including merged tool calls, finish reasons and usage. Content and
+// reasoning deltas are accumulated separately. Chunks with out-of-range choice
+// indexes are skipped and reported as an error once the stream is drained.
+func StreamCollect(chunkChan <-chan *StreamChunk, errChan <-chan error) (SendResponse, error) {
+	var response SendResponse
+	var choices []*Choice
+	var content, reasoning []*strings.Builder
+	var indexErr error
+
+	choiceAt := func(index int) *Choice {
+		for len(choices) <= index {
+			choices = append(choices, nil)
+			content = append(content, &strings.Builder{})
+			reasoning = append(reasoning, &strings.Builder{})
+		}
+		if choices[index] == nil {
+			choices[index] = &Choice{Index: index, Message: &Message{Role: "assistant"}}
+		}
+		return choices[index]
+	}
+
+	for chunk := range chunkChan {
+		if response.ID == "" {
+			response.ID = chunk.ID
+			response.Created = chunk.Created
+			response.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			response.Usage = chunk.Usage
+		}
 
-			lineStr := strings.TrimSpace(string(line))
-			if lineStr == "" {
+		for _, streamChoice := range chunk.Choices {
+			if streamChoice.Index < 0 || streamChoice.Index >= maxStreamChoices {
+				// Keep draining so the streaming goroutine can finish
+				if indexErr == nil {
+					indexErr = fmt.Errorf("invalid choice index %d in stream chunk", streamChoice.Index)
+				}
 				continue
 			}
+			choice := choiceAt(streamChoice.Index)
+			if streamChoice.FinishReason != nil {
+				choice.FinishReason = streamChoice.FinishReason
+			}
+			if d := streamChoice.Delta; d != nil {
+				if d.Role != nil && *d.Role != "" {
+					choice.Message.Role = *d.Role
+				}
+				if d.Content != nil {
+					content[streamChoice.Index].WriteString(*d.Content)
+				}
+				if d.ReasoningContent != nil {
+					reasoning[streamChoice.Index].WriteString(*d.ReasoningContent)
+				}
+				if len(d.ToolCalls) > 0 {
+					choice.Message.ToolCalls = MergeToolCallDeltas(choice.Message.ToolCalls, d.ToolCalls)
+				}
+			}
+		}
+	}
 
-			if strings.HasPrefix(lineStr, "data: ") {
-				data := strings.TrimPrefix(lineStr, "data: ")
+	if err := <-errChan; err != nil {
+		return response, err
+	}
+	if indexErr != nil {
+		return response, indexErr
+	}
 
-				if data == "[DONE]" {
-					return
+	response.Object = "chat.completion"
+	for i, choice := range choices {
+		if choice == nil {
+			continue
+		}
+		choice.Message.Content = content[i].String()
+		choice.Message.ReasoningContent = reasoning[i].String()
+		// Stream indexes are only meaningful while merging deltas
+		for j := range choice.Message.ToolCalls {
+			choice.Message.ToolCalls[j].Index = nil
+		}
+		response.Choices = append(response.Choices, *choice)
+	}
+
+	return response, nil
+}
+
+// MergeToolCallDeltas merges the tool-call fragments of one streaming delta
+// into the tool calls accumulated so far, for callers assembling tool calls
+// from Stream themselves. Fragments are matched by Index, then by ID; a
+// fragment with neither continues the last tool call. Names and arguments
+// are concatenated and the result is ordered by Index. The merged calls keep
+// their Index; it is dropped when they are sent back in a request.
+func MergeToolCallDeltas(existing []ToolCall, delta []ToolCall) []ToolCall {
+	for _, d := range delta {
+		pos := -1
+		for i := range existing {
+			if d.Index != nil && existing[i].Index != nil {
+				if *existing[i].Index == *d.Index {
+					pos = i
+					break
 				}
+			} else if d.ID != "" && existing[i].ID == d.ID {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 && d.Index == nil && d.ID == "" && len(existing) > 0 {
+			pos = len(existing) - 1
+		}
 
-				var chunk StreamChunk
-				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
-					// Skip malformed JSON
-					continue
+		if pos < 0 {
+			call := d
+			if d.Index != nil {
+				index := *d.Index
+				call.Index = &index
+			}
+			// Insert keeping the slice ordered by Index
+			pos = len(existing)
+			if call.Index != nil {
+				for i := range existing {
+					if existing[i].Index != nil && *existing[i].Index > *call.Index {
+						pos = i
+						break
+					}
 				}
+			}
+			existing = append(existing, ToolCall{})
+			copy(existing[pos+1:], existing[pos:])
+			existing[pos] = call
+			continue
+		}
+
+		call := &existing[pos]
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		if d.Type != "" {
+			call.Type = d.Type
+		}
+		call.Function.Name += d.Function.Name
+		call.Function.Arguments += d.Function.Arguments
+	}
+	return existing
+}
 
-				chunkChan <- &chunk
+// UsageTracker accumulates token usage across requests, in total and per
+// model. The zero value is ready to use and it is safe for concurrent use.
+type UsageTracker struct {
+	mu       sync.Mutex
+	total    Usage
+	requests int
+	byModel  map[string]Usage
+}
+
+// Add records the usage of one request made with model
+func (t *UsageTracker) Add(model string, usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.byModel == nil {
+		t.byModel = make(map[string]Usage)
+	}
+	t.total = addUsage(t.total, usage)
+	t.byModel[model] = addUsage(t.byModel[model], usage)
+	t.requests++
+}
+
+// Total returns the usage accumulated across all models
+func (t *UsageTracker) Total() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// Requests returns the number of requests whose usage was recorded
+func (t *UsageTracker) Requests() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.requests
+}
+
+// ByModel returns a copy of the usage accumulated per model
+func (t *UsageTracker) ByModel() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byModel := make(map[string]Usage, len(t.byModel))
+	for model, usage := range t.byModel {
+		byModel[model] = usage
+	}
+	return byModel
+}
+
+func addUsage(a, b Usage) Usage {
+	return Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+	}
+}
+
+// StreamAccumulator forwards streaming chunks while accumulating their text,
+// so the full text received so far can be read at any point during the stream
+type StreamAccumulator struct {
+	mu     sync.Mutex
+	text   strings.Builder
+	chunks chan *StreamChunk
+}
+
+// NewStreamAccumulator wraps a chunk channel returned by Stream. The caller
+// must drain Chunks() until it is closed.
+func NewStreamAccumulator(chunks <-chan *StreamChunk) *StreamAccumulator {
+	a := &StreamAccumulator{
+		chunks: make(chan *StreamChunk, 10),
+	}
+
+	go func() {
+		defer close(a.chunks)
+		for chunk := range chunks {
+			a.mu.Lock()
+			a.text.WriteString(chunk.Text())
+			a.mu.Unlock()
+			a.chunks <- chunk
+		}
+	}()
+
+	return a
+}
+
+// Chunks returns the forwarded chunks, closed once the wrapped channel closes
+func (a *StreamAccumulator) Chunks() <-chan *StreamChunk {
+	return a.chunks
+}
+
+// Text returns the text accumulated so far (safe for concurrent use)
+func (a *StreamAccumulator) Text() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.text.String()
+}
+
+// SplitMode selects the boundary used by SplitStream
+type SplitMode int
+
+const (
+	// SplitSentences emits text ending in '.', '!' or '?' followed by whitespace
+	SplitSentences SplitMode = iota
+	// SplitLines emits text up to each newline
+	SplitLines
+)
+
+// SplitStream buffers the text of the channels returned by Stream and emits
+// it as whole sentences or lines, e.g. for text-to-speech. Sentences are
+// trimmed of surrounding whitespace; lines are emitted without their newline.
+// The final partial unit is emitted when the stream ends.
+func SplitStream(chunkChan <-chan *StreamChunk, errChan <-chan error, mode SplitMode) (<-chan string, <-chan error) {
+	unitChan := make(chan string, 10)
+	outErrChan := make(chan error, 1)
+
+	go func() {
+		defer close(unitChan)
+		defer close(outErrChan)
+
+		emit := func(unit string) {
+			if mode == SplitSentences {
+				unit = strings.TrimSpace(unit)
+				if unit == "" {
+					return
+				}
+			}
+			unitChan <- unit
+		}
+
+		var buffer string
+		for chunk := range chunkChan {
+			buffer += chunk.Text()
+			for {
+				end := nextUnitEnd(buffer, mode)
+				if end < 0 {
+					break
+				}
+				unit := buffer[:end]
+				if mode == SplitLines {
+					unit = strings.TrimSuffix(unit, "\n")
+				}
+				emit(unit)
+				buffer = buffer[end:]
 			}
 		}
+
+		if buffer != "" {
+			emit(buffer)
+		}
+		if err := <-errChan; err != nil {
+			outErrChan <- err
+		}
 	}()
 
-	return struct {
-		ChunkChan <-chan *StreamChunk
-		ErrChan   <-chan error
-	}{ChunkChan: chunkChan, ErrChan: errChan}, nil
+	return unitChan, outErrChan
+}
+
+// nextUnitEnd returns the length of the first complete unit in s, or -1
+func nextUnitEnd(s string, mode SplitMode) int {
+	if mode == SplitLines {
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			return i + 1
+		}
+		return -1
+	}
+
+	// A sentence ends at punctuation only once the following whitespace has
+	// arrived, so "3." followed by "14" in the next chunk is not split
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i] {
+		case '.', '!', '?':
+			switch s[i+1] {
+			case ' ', '\n', '\t', '\r':
+				return i + 1
+			}
+		}
+	}
+	return -1
 }
@@ -1,14 +1,20 @@
 package edgee
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
@@ -153,6 +159,176 @@ func TestNewClient(t *testing.T) {
 	})
 }
 
+func TestNewClientFromFile(t *testing.T) {
+	originalAPIKey := os.Getenv("EDGEE_API_KEY")
+	defer func() {
+		if originalAPIKey != "" {
+			os.Setenv("EDGEE_API_KEY", originalAPIKey)
+		} else {
+			os.Unsetenv("EDGEE_API_KEY")
+		}
+	}()
+	os.Unsetenv("EDGEE_API_KEY")
+
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "edgee.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		return path
+	}
+
+	t.Run("with valid config", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer file-api-key" {
+				t.Errorf("Expected Bearer file-api-key, got %s", r.Header.Get("Authorization"))
+			}
+
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+			if req.Model != "mistral/mistral-small-latest" {
+				t.Errorf("Expected default model, got %s", req.Model)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
+
+		path := writeConfig(t, fmt.Sprintf(`{
+			"api_key": "file-api-key",
+			"base_url": %q,
+			"default_model": "mistral/mistral-small-latest",
+			"timeout": "30s"
+		}`, server.URL))
+
+		client, err := NewClientFromFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if client.timeout != 30*time.Second {
+			t.Errorf("Expected 30s timeout, got %v", client.timeout)
+		}
+		if _, err := client.Send("", "Hello"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("with missing file", func(t *testing.T) {
+		_, err := NewClientFromFile(filepath.Join(t.TempDir(), "missing.json"))
+		if err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+			t.Errorf("Expected read error, got %v", err)
+		}
+	})
+
+	invalid := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"malformed JSON", `{"api_key": `, "invalid config file"},
+		{"unknown field", `{"api_key": "key", "apikey": "typo"}`, `unknown field "apikey"`},
+		{"missing api_key", `{"base_url": "https://api.edgee.ai"}`, "api_key is required"},
+		{"invalid base_url", `{"api_key": "key", "base_url": "api.edgee.ai"}`, "invalid base URL"},
+		{"invalid timeout", `{"api_key": "key", "timeout": "30"}`, `timeout "30" must be a duration`},
+	}
+
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewClientFromFile(writeConfig(t, tc.content))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+		Timeout: 50 * time.Millisecond,
+	})
+
+	_, err := client.Send("gpt-4", "Hello")
+	if err == nil || !strings.Contains(err.Error(), "failed to send request") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
+
+func TestClient_StreamTimeout(t *testing.T) {
+	t.Run("does not cut off a long stream", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/event-stream")
+			flusher := w.(http.Flusher)
+			for _, word := range []string{"Hello", " world"} {
+				fmt.Fprintf(w, "data: {\"id\":\"test\",\"object\":\"chat.completion.chunk\",\"created\":1234567890,\"model\":\"gpt-4\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", word)
+				flusher.Flush()
+				time.Sleep(60 * time.Millisecond)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+			Timeout: 50 * time.Millisecond,
+		})
+
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
+		var text strings.Builder
+		for chunk := range chunkChan {
+			text.WriteString(chunk.Text())
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if text.String() != "Hello world" {
+			t.Errorf("Expected 'Hello world', got %q", text.String())
+		}
+	})
+
+	t.Run("bounds the wait for response headers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+			Timeout: 50 * time.Millisecond,
+		})
+
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
+		for range chunkChan {
+		}
+		err := <-errChan
+		if err == nil || !strings.Contains(err.Error(), "awaiting response headers") {
+			t.Errorf("Expected timeout error, got %v", err)
+		}
+	})
+}
+
 func TestClient_Send(t *testing.T) {
 	t.Run("with string input", func(t *testing.T) {
 		mockResponse := SendResponse{
@@ -448,6 +624,55 @@ func TestClient_Send(t *testing.T) {
 		}
 	})
 
+	t.Run("with strict tool", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if !strings.Contains(string(body), `"strict":true`) {
+				t.Errorf("Expected strict:true in request, got %s", body)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		strict := true
+		input := InputObject{
+			Messages: []Message{{Role: "user", Content: "What is the weather in Paris?"}},
+			Tools: []Tool{
+				{
+					Type: "function",
+					Function: FunctionDefinition{
+						Name:   "get_weather",
+						Strict: &strict,
+						Parameters: map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"location": map[string]any{"type": "string"},
+							},
+							"required":             []string{"location"},
+							"additionalProperties": false,
+						},
+					},
+				},
+			},
+		}
+
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		toolBytes, _ := json.Marshal(Tool{Type: "function", Function: FunctionDefinition{Name: "ping"}})
+		if strings.Contains(string(toolBytes), "strict") {
+			t.Errorf("Expected strict to be omitted when unset, got %s", toolBytes)
+		}
+	})
+
 	t.Run("with tool_choice object", func(t *testing.T) {
 		mockResponse := SendResponse{
 			Choices: []Choice{
@@ -676,108 +901,385 @@ func TestClient_Send(t *testing.T) {
 			t.Errorf("Expected error about unsupported input type, got %v", err)
 		}
 	})
-}
 
-func TestSendResponse_ConvenienceMethods(t *testing.T) {
-	t.Run("Text method", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{
-				{
-					Index: 0,
-					Message: &Message{
-						Role:    "assistant",
-						Content: "Hello, world!",
+	t.Run("with IncludeRequest", func(t *testing.T) {
+		var sent map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &sent)
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:                 "test-api-key",
+			BaseURL:                server.URL,
+			IncludeRequest:         true,
+			DefaultPresencePenalty: float64Ptr(0.5),
+		})
+
+		input := InputObject{
+			Messages: []Message{{Role: "user", Content: "Hello", Name: stringPtr("alice")}},
+			Tools: []Tool{{
+				Type: "function",
+				Function: FunctionDefinition{
+					Name: "get_weather",
+					Parameters: map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"location": map[string]any{"type": "string"}},
 					},
 				},
-			},
+			}},
+			ToolChoice:  "none",
+			Tags:        []string{"replay"},
+			Temperature: float64Ptr(0.7),
+			Extra:       map[string]any{"min_p": 0.05},
 		}
 
-		if response.Text() != "Hello, world!" {
-			t.Errorf("Expected 'Hello, world!', got %s", response.Text())
+		result, err := client.Send("gpt-4", input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
 		}
-	})
-
-	t.Run("Text method with empty choices", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{},
+		if result.Request == nil {
+			t.Fatal("Expected request to be attached")
 		}
 
-		if response.Text() != "" {
-			t.Errorf("Expected empty string, got %s", response.Text())
-		}
-	})
+		// Later edits to the caller's input must not alter the attached request
+		input.Messages[0].Content = "Edited"
+		*input.Messages[0].Name = "edited"
+		input.Tools[0].Function.Name = "edited"
+		input.Tools[0].Function.Parameters["type"] = "edited"
+		input.Tags[0] = "edited"
+		input.Extra["min_p"] = 0.9
 
-	t.Run("Text method with nil message", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{
-				{
-					Index:   0,
-					Message: nil,
-				},
-			},
+		if result.Request.Messages[0].Content != "Hello" {
+			t.Errorf("Expected attached message 'Hello', got %s", result.Request.Messages[0].Content)
 		}
-
-		if response.Text() != "" {
-			t.Errorf("Expected empty string, got %s", response.Text())
+		if name := result.Request.Messages[0].Name; name == nil || *name != "alice" {
+			t.Errorf("Expected attached message name 'alice', got %v", name)
 		}
-	})
-
-	t.Run("MessageContent method", func(t *testing.T) {
-		msg := &Message{
-			Role:    "assistant",
-			Content: "Hello, world!",
+		if len(result.Request.Tools) != 1 || result.Request.Tools[0].Function.Name != "get_weather" {
+			t.Errorf("Expected attached tool get_weather, got %+v", result.Request.Tools)
+		} else if result.Request.Tools[0].Function.Parameters["type"] != "object" {
+			t.Errorf("Expected attached tool parameters type 'object', got %v", result.Request.Tools[0].Function.Parameters["type"])
 		}
-		response := &SendResponse{
-			Choices: []Choice{
-				{
-					Index:   0,
-					Message: msg,
-				},
-			},
+		if result.Request.Extra["min_p"] != 0.05 {
+			t.Errorf("Expected attached extra min_p 0.05, got %v", result.Request.Extra["min_p"])
+		}
+		if result.Request.Temperature == nil || *result.Request.Temperature != 0.7 {
+			t.Errorf("Expected temperature 0.7, got %v", result.Request.Temperature)
+		}
+		if result.Request.PresencePenalty == nil || *result.Request.PresencePenalty != 0.5 {
+			t.Errorf("Expected default presence_penalty 0.5, got %v", result.Request.PresencePenalty)
+		}
+		if result.Request.Model != "gpt-4" {
+			t.Errorf("Expected model gpt-4, got %s", result.Request.Model)
+		}
+		if result.Request.ToolChoice != "none" {
+			t.Errorf("Expected tool_choice 'none', got %v", result.Request.ToolChoice)
+		}
+		if len(result.Request.Tags) != 1 || result.Request.Tags[0] != "replay" {
+			t.Errorf("Expected tags [replay], got %v", result.Request.Tags)
 		}
 
-		if response.MessageContent() != msg {
-			t.Error("Expected message to match")
+		// Replaying the attached request sends the same body
+		replayed, err := json.Marshal(result.Request)
+		if err != nil {
+			t.Fatalf("Failed to marshal attached request: %v", err)
+		}
+		var replayedBody map[string]any
+		json.Unmarshal(replayed, &replayedBody)
+		if !reflect.DeepEqual(sent, replayedBody) {
+			t.Errorf("Expected replayed body to match sent body:\nsent:     %v\nreplayed: %v", sent, replayedBody)
 		}
 	})
 
-	t.Run("MessageContent method with empty choices", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{},
-		}
+	t.Run("without IncludeRequest", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
 
-		if response.MessageContent() != nil {
-			t.Error("Expected nil message")
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		result, err := client.Send("gpt-4", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Request != nil {
+			t.Errorf("Expected no request attached, got %+v", result.Request)
 		}
 	})
 
-	t.Run("FinishReason method", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{
-				{
-					Index:        0,
-					FinishReason: stringPtr("stop"),
-				},
-			},
-		}
+	t.Run("with non-JSON success response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Upstream proxy error: bad gateway"))
+		}))
+		defer server.Close()
 
-		if response.FinishReason() != "stop" {
-			t.Errorf("Expected 'stop', got %s", response.FinishReason())
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		_, err := client.Send("gpt-4", "Hello")
+		if err == nil {
+			t.Fatal("Expected error for text/plain response")
+		}
+		if !strings.Contains(err.Error(), `unexpected content type "text/plain; charset=utf-8"`) {
+			t.Errorf("Expected content type error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "Upstream proxy error: bad gateway") {
+			t.Errorf("Expected body snippet in error, got %v", err)
 		}
 	})
 
-	t.Run("FinishReason method with nil", func(t *testing.T) {
-		response := &SendResponse{
-			Choices: []Choice{
-				{
-					Index:        0,
-					FinishReason: nil,
-				},
+	t.Run("with echoed metadata", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &req); err != nil {
+				t.Fatalf("Failed to unmarshal request: %v", err)
+			}
+
+			// Echo the request metadata like the gateway does
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id", Metadata: req.Metadata})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		metadata := map[string]string{"team": "search", "env": "prod"}
+		inputs := map[string]any{
+			"InputObject":  InputObject{Messages: []Message{{Role: "user", Content: "Hello"}}, Metadata: metadata},
+			"*InputObject": &InputObject{Messages: []Message{{Role: "user", Content: "Hello"}}, Metadata: metadata},
+			"map": map[string]any{
+				"messages": []map[string]string{{"role": "user", "content": "Hello"}},
+				"metadata": map[string]any{"team": "search", "env": "prod"},
 			},
 		}
-
-		if response.FinishReason() != "" {
-			t.Errorf("Expected empty string, got %s", response.FinishReason())
+		for name, input := range inputs {
+			response, err := client.Send("gpt-4", input)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", name, err)
+			}
+			if !reflect.DeepEqual(response.Metadata, metadata) {
+				t.Errorf("%s: expected echoed metadata %v, got %v", name, metadata, response.Metadata)
+			}
+		}
+	})
+
+	t.Run("with invalid map metadata", func(t *testing.T) {
+		client, _ := NewClient(&Config{APIKey: "test-api-key"})
+
+		_, err := client.Send("gpt-4", map[string]any{
+			"messages": []map[string]string{{"role": "user", "content": "Hello"}},
+			"metadata": map[string]any{"retries": 3},
+		})
+		if err == nil || !strings.Contains(err.Error(), "metadata") {
+			t.Errorf("Expected metadata error, got %v", err)
+		}
+	})
+
+	t.Run("with rate-limit headers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("x-ratelimit-limit-requests", "500")
+			w.Header().Set("x-ratelimit-remaining-requests", "499")
+			w.Header().Set("x-ratelimit-reset-requests", "120ms")
+			w.Header().Set("x-ratelimit-limit-tokens", "30000")
+			w.Header().Set("x-ratelimit-remaining-tokens", "29950")
+			w.Header().Set("x-ratelimit-reset-tokens", "6m0s")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		response, err := client.Send("gpt-4", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		expected := RateLimit{
+			LimitRequests:     500,
+			RemainingRequests: 499,
+			ResetRequests:     120 * time.Millisecond,
+			LimitTokens:       30000,
+			RemainingTokens:   29950,
+			ResetTokens:       6 * time.Minute,
+		}
+		if response.RateLimit == nil {
+			t.Fatal("Expected rate limit to be parsed")
+		}
+		if *response.RateLimit != expected {
+			t.Errorf("Expected %+v, got %+v", expected, *response.RateLimit)
+		}
+	})
+
+	t.Run("without rate-limit headers", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		response, err := client.Send("gpt-4", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if response.RateLimit != nil {
+			t.Errorf("Expected no rate limit, got %+v", response.RateLimit)
+		}
+	})
+
+	t.Run("with no messages", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Expected no request to be sent")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		for _, input := range []any{InputObject{}, &InputObject{}, map[string]any{"tool_choice": "auto"}} {
+			_, err := client.Send("gpt-4", input)
+			if err == nil || !strings.Contains(err.Error(), "at least one message is required") {
+				t.Errorf("Expected missing messages error for %T, got %v", input, err)
+			}
+		}
+
+		chunkChan, errChan := client.Stream("gpt-4", InputObject{})
+		for range chunkChan {
+		}
+		if err := <-errChan; err == nil || !strings.Contains(err.Error(), "at least one message is required") {
+			t.Errorf("Expected missing messages error when streaming, got %v", err)
+		}
+	})
+}
+
+func TestSendResponse_ConvenienceMethods(t *testing.T) {
+	t.Run("Text method", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{
+				{
+					Index: 0,
+					Message: &Message{
+						Role:    "assistant",
+						Content: "Hello, world!",
+					},
+				},
+			},
+		}
+
+		if response.Text() != "Hello, world!" {
+			t.Errorf("Expected 'Hello, world!', got %s", response.Text())
+		}
+	})
+
+	t.Run("Text method with empty choices", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{},
+		}
+
+		if response.Text() != "" {
+			t.Errorf("Expected empty string, got %s", response.Text())
+		}
+	})
+
+	t.Run("Text method with nil message", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{
+				{
+					Index:   0,
+					Message: nil,
+				},
+			},
+		}
+
+		if response.Text() != "" {
+			t.Errorf("Expected empty string, got %s", response.Text())
+		}
+	})
+
+	t.Run("MessageContent method", func(t *testing.T) {
+		msg := &Message{
+			Role:    "assistant",
+			Content: "Hello, world!",
+		}
+		response := &SendResponse{
+			Choices: []Choice{
+				{
+					Index:   0,
+					Message: msg,
+				},
+			},
+		}
+
+		if response.MessageContent() != msg {
+			t.Error("Expected message to match")
+		}
+	})
+
+	t.Run("MessageContent method with empty choices", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{},
+		}
+
+		if response.MessageContent() != nil {
+			t.Error("Expected nil message")
+		}
+	})
+
+	t.Run("FinishReason method", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{
+				{
+					Index:        0,
+					FinishReason: stringPtr("stop"),
+				},
+			},
+		}
+
+		if response.FinishReason() != "stop" {
+			t.Errorf("Expected 'stop', got %s", response.FinishReason())
+		}
+	})
+
+	t.Run("FinishReason method with nil", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{
+				{
+					Index:        0,
+					FinishReason: nil,
+				},
+			},
+		}
+
+		if response.FinishReason() != "" {
+			t.Errorf("Expected empty string, got %s", response.FinishReason())
 		}
 	})
 
@@ -822,6 +1324,42 @@ func TestSendResponse_ConvenienceMethods(t *testing.T) {
 			t.Error("Expected nil tool calls")
 		}
 	})
+
+	t.Run("Annotations method", func(t *testing.T) {
+		var response SendResponse
+		body := `{"id":"test-id","object":"chat.completion","created":1234567890,"model":"gpt-4o-search-preview","choices":[{"index":0,"message":{"role":"assistant","content":"Paris is the capital of France.","annotations":[{"type":"url_citation","url_citation":{"start_index":0,"end_index":31,"url":"https://en.wikipedia.org/wiki/Paris","title":"Paris - Wikipedia"}},{"type":"file_citation","file_citation":{"file_id":"file-123","filename":"atlas.pdf"}}]},"finish_reason":"stop"}]}`
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		annotations := response.Annotations()
+		if len(annotations) != 2 {
+			t.Fatalf("Expected 2 annotations, got %d", len(annotations))
+		}
+
+		expected := URLCitation{
+			StartIndex: 0,
+			EndIndex:   31,
+			URL:        "https://en.wikipedia.org/wiki/Paris",
+			Title:      "Paris - Wikipedia",
+		}
+		if annotations[0].Type != "url_citation" || annotations[0].URLCitation == nil || *annotations[0].URLCitation != expected {
+			t.Errorf("Expected URL citation %+v, got %+v", expected, annotations[0])
+		}
+		if annotations[1].Type != "file_citation" || annotations[1].FileCitation == nil || annotations[1].FileCitation.FileID != "file-123" {
+			t.Errorf("Expected file citation for file-123, got %+v", annotations[1])
+		}
+	})
+
+	t.Run("Annotations method with empty choices", func(t *testing.T) {
+		response := &SendResponse{
+			Choices: []Choice{},
+		}
+
+		if response.Annotations() != nil {
+			t.Error("Expected nil annotations")
+		}
+	})
 }
 
 func TestClient_ChatCompletion(t *testing.T) {
@@ -1037,79 +1575,340 @@ func TestClient_Stream(t *testing.T) {
 			t.Errorf("Expected 'Valid', got %s", chunks[0].Text())
 		}
 	})
-}
 
-func TestStreamChunk_ConvenienceMethods(t *testing.T) {
-	t.Run("Text method", func(t *testing.T) {
-		content := "Hello"
-		chunk := &StreamChunk{
-			Choices: []StreamChoice{
-				{
-					Index: 0,
-					Delta: &StreamDelta{
-						Content: &content,
-					},
-				},
-			},
+	t.Run("with SuppressEmptyChunks", func(t *testing.T) {
+		mockChunks := []string{
+			`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+			`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+			`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":null}]}`,
+			`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+			`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
 		}
 
-		if chunk.Text() != "Hello" {
-			t.Errorf("Expected 'Hello', got %s", chunk.Text())
-		}
-	})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range mockChunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
 
-	t.Run("Text method with nil delta", func(t *testing.T) {
-		chunk := &StreamChunk{
-			Choices: []StreamChoice{
-				{
-					Index: 0,
-					Delta: nil,
-				},
-			},
-		}
+		client, _ := NewClient(&Config{
+			APIKey:              "test-api-key",
+			BaseURL:             server.URL,
+			SuppressEmptyChunks: true,
+		})
 
-		if chunk.Text() != "" {
-			t.Errorf("Expected empty string, got %s", chunk.Text())
-		}
-	})
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
 
-	t.Run("Text method with nil content", func(t *testing.T) {
-		chunk := &StreamChunk{
-			Choices: []StreamChoice{
-				{
-					Index: 0,
-					Delta: &StreamDelta{
-						Content: nil,
-					},
-				},
-			},
+		chunks := []*StreamChunk{}
+		for chunk := range chunkChan {
+			chunks = append(chunks, chunk)
 		}
-
-		if chunk.Text() != "" {
-			t.Errorf("Expected empty string, got %s", chunk.Text())
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
 		}
-	})
 
-	t.Run("Role method", func(t *testing.T) {
-		role := "assistant"
-		chunk := &StreamChunk{
-			Choices: []StreamChoice{
-				{
-					Index: 0,
-					Delta: &StreamDelta{
-						Role: &role,
-					},
-				},
-			},
+		if len(chunks) != 3 {
+			t.Fatalf("Expected 3 chunks, got %d", len(chunks))
 		}
-
-		if chunk.Role() != "assistant" {
-			t.Errorf("Expected 'assistant', got %s", chunk.Role())
+		if chunks[0].Text() != "Hello" {
+			t.Errorf("Expected 'Hello', got %s", chunks[0].Text())
+		}
+		if len(chunks[1].Choices[0].Delta.ToolCalls) != 1 {
+			t.Errorf("Expected tool call delta to be kept, got %+v", chunks[1].Choices[0].Delta)
+		}
+		if chunks[2].FinishReason() != "stop" {
+			t.Errorf("Expected finish_reason 'stop', got %s", chunks[2].FinishReason())
 		}
 	})
 
-	t.Run("Role method with nil", func(t *testing.T) {
-		chunk := &StreamChunk{
+	t.Run("with StreamFallback", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if req.Stream {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"This model does not support streaming"}}`))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{
+				ID:    "test-id",
+				Model: "o1",
+				Choices: []Choice{{
+					Message:      &Message{Role: "assistant", Content: "Full answer"},
+					FinishReason: stringPtr("stop"),
+				}},
+			})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:         "test-api-key",
+			BaseURL:        server.URL,
+			StreamFallback: true,
+		})
+
+		chunkChan, errChan := client.Stream("o1", "Hello")
+		chunks := []*StreamChunk{}
+		for chunk := range chunkChan {
+			chunks = append(chunks, chunk)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(chunks) != 1 {
+			t.Fatalf("Expected 1 chunk, got %d", len(chunks))
+		}
+		if chunks[0].Text() != "Full answer" {
+			t.Errorf("Expected 'Full answer', got %s", chunks[0].Text())
+		}
+		if chunks[0].FinishReason() != "stop" {
+			t.Errorf("Expected finish_reason 'stop', got %s", chunks[0].FinishReason())
+		}
+
+		// Without the fallback the streaming error is returned as-is
+		client, _ = NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+		chunkChan, errChan = client.Stream("o1", "Hello")
+		for range chunkChan {
+		}
+		if err := <-errChan; err == nil || !strings.Contains(err.Error(), "API error 400") {
+			t.Errorf("Expected API error 400, got %v", err)
+		}
+	})
+
+	t.Run("with StreamFallback applies stream handling", func(t *testing.T) {
+		content := "Full answer"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if req.Stream {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"This model does not support streaming"}}`))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{
+				ID:      "test-id",
+				Model:   "o1",
+				Choices: []Choice{{Message: &Message{Role: "assistant", Content: content}}},
+			})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:                  "test-api-key",
+			BaseURL:                 server.URL,
+			StreamFallback:          true,
+			SuppressEmptyChunks:     true,
+			TreatEmptyStreamAsError: true,
+		})
+
+		// The fallback chunk is recorded and replays identically
+		var fixture bytes.Buffer
+		chunkChan, errChan := client.StreamRecord("o1", "Hello", &fixture)
+		recorded := []*StreamChunk{}
+		for chunk := range chunkChan {
+			recorded = append(recorded, chunk)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(recorded) != 1 || recorded[0].Text() != "Full answer" {
+			t.Fatalf("Expected a single 'Full answer' chunk, got %d chunks", len(recorded))
+		}
+
+		chunkChan, errChan = ReplayStream(&fixture)
+		replayed := []*StreamChunk{}
+		for chunk := range chunkChan {
+			replayed = append(replayed, chunk)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected replay error: %v", err)
+		}
+		if !reflect.DeepEqual(recorded, replayed) {
+			t.Errorf("Expected replayed chunks to match recorded chunks")
+		}
+
+		// An empty fallback response is suppressed and reported
+		content = ""
+		chunkChan, errChan = client.Stream("o1", "Hello")
+		count := 0
+		for range chunkChan {
+			count++
+		}
+		if count != 0 {
+			t.Errorf("Expected the empty chunk to be suppressed, got %d chunks", count)
+		}
+		if err := <-errChan; !errors.Is(err, ErrEmptyStream) {
+			t.Errorf("Expected ErrEmptyStream, got %v", err)
+		}
+	})
+
+	t.Run("with StreamFallback and an unrelated 400", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"upstream provider rejected max_tokens","param":"max_tokens"}}`))
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:         "test-api-key",
+			BaseURL:        server.URL,
+			StreamFallback: true,
+		})
+
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
+		for range chunkChan {
+		}
+		err := <-errChan
+		if err == nil || !strings.Contains(err.Error(), "upstream provider rejected max_tokens") {
+			t.Errorf("Expected the original API error, got %v", err)
+		}
+		if requests != 1 {
+			t.Errorf("Expected no fallback request, got %d requests", requests)
+		}
+	})
+
+	t.Run("detects streaming unsupported errors", func(t *testing.T) {
+		cases := []struct {
+			status   int
+			body     string
+			expected bool
+		}{
+			{http.StatusBadRequest, `{"error":{"message":"Unsupported value: 'stream' does not support true with this model.","param":"stream","code":"unsupported_value"}}`, true},
+			{http.StatusBadRequest, `{"error":{"message":"This model does not support streaming"}}`, true},
+			{http.StatusNotImplemented, `stream not supported`, true},
+			{http.StatusBadRequest, `{"error":{"message":"upstream provider rejected max_tokens"}}`, false},
+			{http.StatusBadRequest, `{"error":{"message":"invalid stream_options"}}`, false},
+			{http.StatusInternalServerError, `This model does not support streaming`, false},
+		}
+		for _, tc := range cases {
+			if got := isStreamingUnsupported(tc.status, []byte(tc.body)); got != tc.expected {
+				t.Errorf("isStreamingUnsupported(%d, %s) = %v, expected %v", tc.status, tc.body, got, tc.expected)
+			}
+		}
+	})
+
+	t.Run("with TreatEmptyStreamAsError", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:                  "test-api-key",
+			BaseURL:                 server.URL,
+			TreatEmptyStreamAsError: true,
+		})
+
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
+		for range chunkChan {
+		}
+		if err := <-errChan; !errors.Is(err, ErrEmptyStream) {
+			t.Errorf("Expected ErrEmptyStream, got %v", err)
+		}
+
+		// Without the client default an empty stream just ends
+		client, _ = NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+		chunkChan, errChan = client.Stream("gpt-4", "Hello")
+		for range chunkChan {
+		}
+		if err := <-errChan; err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+}
+
+func TestStreamChunk_ConvenienceMethods(t *testing.T) {
+	t.Run("Text method", func(t *testing.T) {
+		content := "Hello"
+		chunk := &StreamChunk{
+			Choices: []StreamChoice{
+				{
+					Index: 0,
+					Delta: &StreamDelta{
+						Content: &content,
+					},
+				},
+			},
+		}
+
+		if chunk.Text() != "Hello" {
+			t.Errorf("Expected 'Hello', got %s", chunk.Text())
+		}
+	})
+
+	t.Run("Text method with nil delta", func(t *testing.T) {
+		chunk := &StreamChunk{
+			Choices: []StreamChoice{
+				{
+					Index: 0,
+					Delta: nil,
+				},
+			},
+		}
+
+		if chunk.Text() != "" {
+			t.Errorf("Expected empty string, got %s", chunk.Text())
+		}
+	})
+
+	t.Run("Text method with nil content", func(t *testing.T) {
+		chunk := &StreamChunk{
+			Choices: []StreamChoice{
+				{
+					Index: 0,
+					Delta: &StreamDelta{
+						Content: nil,
+					},
+				},
+			},
+		}
+
+		if chunk.Text() != "" {
+			t.Errorf("Expected empty string, got %s", chunk.Text())
+		}
+	})
+
+	t.Run("Role method", func(t *testing.T) {
+		role := "assistant"
+		chunk := &StreamChunk{
+			Choices: []StreamChoice{
+				{
+					Index: 0,
+					Delta: &StreamDelta{
+						Role: &role,
+					},
+				},
+			},
+		}
+
+		if chunk.Role() != "assistant" {
+			t.Errorf("Expected 'assistant', got %s", chunk.Role())
+		}
+	})
+
+	t.Run("Role method with nil", func(t *testing.T) {
+		chunk := &StreamChunk{
 			Choices: []StreamChoice{
 				{
 					Index: 0,
@@ -1166,7 +1965,1435 @@ func TestStreamChunk_ConvenienceMethods(t *testing.T) {
 	})
 }
 
-// Helper function to create string pointer
-func stringPtr(s string) *string {
-	return &s
+func TestStreamAccumulator(t *testing.T) {
+	mockChunks := []string{
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":" wide"},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range mockChunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	chunkChan, errChan := client.Stream("gpt-4", "Hello")
+	acc := NewStreamAccumulator(chunkChan)
+
+	var streamed strings.Builder
+	previous := ""
+	count := 0
+	for chunk := range acc.Chunks() {
+		count++
+		streamed.WriteString(chunk.Text())
+
+		snapshot := acc.Text()
+		if !strings.HasPrefix(snapshot, previous) {
+			t.Errorf("Expected %q to extend %q", snapshot, previous)
+		}
+		if !strings.HasPrefix(snapshot, streamed.String()) {
+			t.Errorf("Expected %q to include forwarded text %q", snapshot, streamed.String())
+		}
+		previous = snapshot
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != len(mockChunks) {
+		t.Errorf("Expected %d forwarded chunks, got %d", len(mockChunks), count)
+	}
+	if acc.Text() != "Hello wide world" {
+		t.Errorf("Expected 'Hello wide world', got %q", acc.Text())
+	}
+}
+
+func TestClient_SamplingDefaults(t *testing.T) {
+	var captured Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured = Request{}
+		json.Unmarshal(body, &captured)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:                 "test-api-key",
+		BaseURL:                server.URL,
+		DefaultTemperature:     float64Ptr(0.2),
+		DefaultPresencePenalty: float64Ptr(0.5),
+	})
+
+	t.Run("uses client defaults", func(t *testing.T) {
+		if _, err := client.Send("gpt-4", "Hello"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured.Temperature == nil || *captured.Temperature != 0.2 {
+			t.Errorf("Expected temperature 0.2, got %v", captured.Temperature)
+		}
+		if captured.PresencePenalty == nil || *captured.PresencePenalty != 0.5 {
+			t.Errorf("Expected presence_penalty 0.5, got %v", captured.PresencePenalty)
+		}
+		if captured.FrequencyPenalty != nil {
+			t.Errorf("Expected no frequency_penalty, got %v", *captured.FrequencyPenalty)
+		}
+	})
+
+	t.Run("InputObject overrides defaults", func(t *testing.T) {
+		input := InputObject{
+			Messages:    []Message{{Role: "user", Content: "Hello"}},
+			Temperature: float64Ptr(0),
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured.Temperature == nil || *captured.Temperature != 0 {
+			t.Errorf("Expected temperature 0, got %v", captured.Temperature)
+		}
+		if captured.PresencePenalty == nil || *captured.PresencePenalty != 0.5 {
+			t.Errorf("Expected presence_penalty 0.5, got %v", captured.PresencePenalty)
+		}
+	})
+
+	t.Run("map input overrides defaults", func(t *testing.T) {
+		input := map[string]any{
+			"messages":          []map[string]string{{"role": "user", "content": "Hello"}},
+			"temperature":       1,
+			"frequency_penalty": 0.3,
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured.Temperature == nil || *captured.Temperature != 1 {
+			t.Errorf("Expected temperature 1, got %v", captured.Temperature)
+		}
+		if captured.FrequencyPenalty == nil || *captured.FrequencyPenalty != 0.3 {
+			t.Errorf("Expected frequency_penalty 0.3, got %v", captured.FrequencyPenalty)
+		}
+	})
+
+	t.Run("map input with invalid value", func(t *testing.T) {
+		input := map[string]any{
+			"messages":    []map[string]string{{"role": "user", "content": "Hello"}},
+			"temperature": "hot",
+		}
+		_, err := client.Send("gpt-4", input)
+		if err == nil {
+			t.Fatal("Expected error for invalid temperature")
+		}
+		if !strings.Contains(err.Error(), "temperature") {
+			t.Errorf("Expected error about temperature, got %v", err)
+		}
+	})
+}
+
+func TestFunctionDefinition_ValidateSchema(t *testing.T) {
+	t.Run("valid schema", func(t *testing.T) {
+		def := FunctionDefinition{
+			Name: "get_weather",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"location": map[string]string{"type": "string"},
+					"days":     map[string]any{"type": []string{"integer", "null"}},
+					"units": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+				},
+				"required": []string{"location"},
+			},
+		}
+		if err := def.ValidateSchema(); err != nil {
+			t.Errorf("Expected valid schema, got %v", err)
+		}
+	})
+
+	t.Run("nil parameters", func(t *testing.T) {
+		def := FunctionDefinition{Name: "ping"}
+		if err := def.ValidateSchema(); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	invalid := []struct {
+		name       string
+		parameters map[string]any
+		expected   string
+	}{
+		{
+			name:       "missing object type",
+			parameters: map[string]any{"properties": map[string]any{}},
+			expected:   `type must be "object"`,
+		},
+		{
+			name: "required is not an array",
+			parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"location": map[string]any{"type": "string"}},
+				"required":   "location",
+			},
+			expected: "required must be an array",
+		},
+		{
+			name: "required contains non-string",
+			parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"location": map[string]any{"type": "string"}},
+				"required":   []any{1},
+			},
+			expected: "must contain only strings",
+		},
+		{
+			name: "required references unknown property",
+			parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"location": map[string]any{"type": "string"}},
+				"required":   []string{"city"},
+			},
+			expected: `unknown property "city"`,
+		},
+		{
+			name: "invalid property type",
+			parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"location": map[string]any{"type": "text"}},
+			},
+			expected: `parameters.properties.location.type "text"`,
+		},
+		{
+			name: "property is not a schema",
+			parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"location": "string"},
+			},
+			expected: "properties.location must be an object",
+		},
+		{
+			name: "invalid nested items type",
+			parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"tags": map[string]any{"type": "array", "items": map[string]any{"type": "str"}},
+				},
+			},
+			expected: "properties.tags.items.type",
+		},
+	}
+
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			def := FunctionDefinition{Name: "get_weather", Parameters: tc.parameters}
+			err := def.ValidateSchema()
+			if err == nil {
+				t.Fatal("Expected validation error")
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestFunctionDefinition_Clone(t *testing.T) {
+	newDefinition := func() *FunctionDefinition {
+		return &FunctionDefinition{
+			Name:        "get_weather",
+			Description: stringPtr("Get the weather for a location"),
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"location": map[string]string{"type": "string"},
+					"units":    map[string]any{"type": "string", "enum": []string{"celsius", "fahrenheit"}},
+				},
+				"required": []string{"location"},
+			},
+		}
+	}
+
+	t.Run("clone with required override", func(t *testing.T) {
+		original := newDefinition()
+
+		clone, err := original.Clone().WithRequired("location", "units")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		*clone.Description = "Get the weather in a given unit"
+		clone.Parameters["properties"].(map[string]any)["units"].(map[string]any)["enum"].([]string)[0] = "kelvin"
+
+		if !reflect.DeepEqual(clone.Parameters["required"], []string{"location", "units"}) {
+			t.Errorf("Expected clone to require location and units, got %v", clone.Parameters["required"])
+		}
+		if err := clone.ValidateSchema(); err != nil {
+			t.Errorf("Expected clone schema to be valid, got %v", err)
+		}
+		if !reflect.DeepEqual(original, newDefinition()) {
+			t.Errorf("Expected original to be unchanged, got %+v", original.Parameters)
+		}
+	})
+
+	t.Run("without required parameters", func(t *testing.T) {
+		clone, err := newDefinition().Clone().WithRequired()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := clone.Parameters["required"]; ok {
+			t.Errorf("Expected no required parameters, got %v", clone.Parameters["required"])
+		}
+	})
+
+	t.Run("with unknown property", func(t *testing.T) {
+		original := newDefinition()
+		_, err := original.Clone().WithRequired("city")
+		if err == nil || !strings.Contains(err.Error(), `unknown property "city"`) {
+			t.Errorf("Expected unknown property error, got %v", err)
+		}
+	})
+
+	t.Run("without parameters", func(t *testing.T) {
+		def := FunctionDefinition{Name: "ping"}
+		if clone := def.Clone(); clone.Parameters != nil {
+			t.Errorf("Expected nil parameters, got %v", clone.Parameters)
+		}
+		if _, err := def.WithRequired("location"); err == nil {
+			t.Error("Expected error for a definition without parameters")
+		}
+	})
+}
+
+func TestClient_StreamJSON(t *testing.T) {
+	newServer := func(fragments []string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req map[string]any
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if _, ok := req["response_format"]; !ok {
+				t.Error("Expected response_format to be sent")
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, fragment := range fragments {
+				content, _ := json.Marshal(fragment)
+				fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":%s},"finish_reason":null}]}`+"\n\n", content)
+			}
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+	}
+
+	input := InputObject{
+		Messages: []Message{{Role: "user", Content: "Describe Paris"}},
+		ResponseFormat: map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name": "city",
+				"schema": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":       map[string]any{"type": "string"},
+						"population": map[string]any{"type": "integer"},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("unmarshals streamed content", func(t *testing.T) {
+		server := newServer([]string{`{"name":`, `"Paris",`, `"population":`, `2100000}`})
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		var city struct {
+			Name       string `json:"name"`
+			Population int    `json:"population"`
+		}
+		if err := client.StreamJSON("gpt-4", input, &city); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if city.Name != "Paris" || city.Population != 2100000 {
+			t.Errorf("Expected Paris/2100000, got %+v", city)
+		}
+	})
+
+	t.Run("with invalid JSON content", func(t *testing.T) {
+		server := newServer([]string{`{"name":`, `"Paris"`})
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		var city map[string]any
+		err := client.StreamJSON("gpt-4", input, &city)
+		if err == nil {
+			t.Fatal("Expected error for incomplete JSON")
+		}
+		if !strings.Contains(err.Error(), "failed to unmarshal streamed content") {
+			t.Errorf("Expected unmarshal error, got %v", err)
+		}
+	})
+}
+
+func TestWithBaseURL(t *testing.T) {
+	newServer := func(content string, hits *int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*hits++
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{
+				Choices: []Choice{{Message: &Message{Role: "assistant", Content: content}}},
+			})
+		}))
+	}
+
+	var defaultHits, regionalHits int
+	defaultServer := newServer("default", &defaultHits)
+	defer defaultServer.Close()
+	regionalServer := newServer("regional", &regionalHits)
+	defer regionalServer.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: defaultServer.URL,
+	})
+
+	t.Run("overrides base URL for one request", func(t *testing.T) {
+		response, err := client.Send("gpt-4", "Hello", WithBaseURL(regionalServer.URL))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if response.Text() != "regional" {
+			t.Errorf("Expected 'regional', got %s", response.Text())
+		}
+
+		response, err = client.Send("gpt-4", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if response.Text() != "default" {
+			t.Errorf("Expected 'default', got %s", response.Text())
+		}
+
+		if regionalHits != 1 || defaultHits != 1 {
+			t.Errorf("Expected one hit per server, got regional=%d default=%d", regionalHits, defaultHits)
+		}
+	})
+
+	t.Run("with invalid URL", func(t *testing.T) {
+		for _, baseURL := range []string{"", "not a url", "ftp://example.com", "://missing-scheme"} {
+			_, err := client.Send("gpt-4", "Hello", WithBaseURL(baseURL))
+			if err == nil {
+				t.Errorf("Expected error for base URL %q", baseURL)
+				continue
+			}
+			if !strings.Contains(err.Error(), "invalid base URL") {
+				t.Errorf("Expected invalid base URL error, got %v", err)
+			}
+		}
+	})
+
+	t.Run("with invalid URL when streaming", func(t *testing.T) {
+		chunkChan, errChan := client.Stream("gpt-4", "Hello", WithBaseURL("example.com"))
+		for range chunkChan {
+		}
+		err := <-errChan
+		if err == nil || !strings.Contains(err.Error(), "invalid base URL") {
+			t.Errorf("Expected invalid base URL error, got %v", err)
+		}
+	})
+}
+
+func TestStreamRecordAndReplay(t *testing.T) {
+	mockChunks := []string{
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]},"finish_reason":null}]}`,
+		`{"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range mockChunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprintf(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	var fixture bytes.Buffer
+	chunkChan, errChan := client.StreamRecord("gpt-4", "Hello", &fixture)
+	recorded := []*StreamChunk{}
+	for chunk := range chunkChan {
+		recorded = append(recorded, chunk)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(recorded) != len(mockChunks) {
+		t.Fatalf("Expected %d chunks, got %d", len(mockChunks), len(recorded))
+	}
+	if !strings.Contains(fixture.String(), "data: [DONE]") {
+		t.Errorf("Expected fixture to contain the raw SSE, got %q", fixture.String())
+	}
+
+	chunkChan, errChan = ReplayStream(&fixture)
+	replayed := []*StreamChunk{}
+	for chunk := range chunkChan {
+		replayed = append(replayed, chunk)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Errorf("Expected replayed chunks to match recorded chunks")
+	}
+
+	// A shared options slice with spare capacity must not be written to
+	shared := make([]RequestOption, 1, 2)
+	shared[0] = WithBaseURL(server.URL)
+	chunkChan, errChan = client.StreamRecord("gpt-4", "Hello", io.Discard, shared...)
+	for range chunkChan {
+	}
+	if err := <-errChan; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if shared[:2][1] != nil {
+		t.Error("Expected StreamRecord to leave the caller's options slice untouched")
+	}
+}
+
+func TestClient_SafetySettings(t *testing.T) {
+	var captured map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured = nil
+		json.Unmarshal(body, &captured)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	safe := true
+	input := InputObject{
+		Messages:   []Message{{Role: "user", Content: "Hello"}},
+		SafePrompt: &safe,
+	}
+
+	t.Run("omitted by default", func(t *testing.T) {
+		if _, err := client.Send("mistral/mistral-small-latest", "Hello"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := captured["safe_prompt"]; ok {
+			t.Error("Expected safe_prompt to be omitted")
+		}
+		if _, ok := captured["safety"]; ok {
+			t.Error("Expected safety to be omitted")
+		}
+	})
+
+	t.Run("from InputObject", func(t *testing.T) {
+		if _, err := client.Send("mistral/mistral-small-latest", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["safe_prompt"] != true {
+			t.Errorf("Expected safe_prompt true, got %v", captured["safe_prompt"])
+		}
+	})
+
+	t.Run("option overrides InputObject", func(t *testing.T) {
+		if _, err := client.Send("mistral/mistral-small-latest", input, WithSafePrompt(false)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["safe_prompt"] != false {
+			t.Errorf("Expected safe_prompt false, got %v", captured["safe_prompt"])
+		}
+	})
+
+	t.Run("from map input", func(t *testing.T) {
+		mapInput := map[string]any{
+			"messages":    []map[string]string{{"role": "user", "content": "Hello"}},
+			"safe_prompt": true,
+		}
+		if _, err := client.Send("mistral/mistral-small-latest", mapInput); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["safe_prompt"] != true {
+			t.Errorf("Expected safe_prompt true, got %v", captured["safe_prompt"])
+		}
+	})
+
+	t.Run("with safety passthrough", func(t *testing.T) {
+		settings := map[string]any{"harassment": "block_only_high"}
+		if _, err := client.Send("gpt-4", "Hello", WithSafety(settings)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		safety, ok := captured["safety"].(map[string]any)
+		if !ok || safety["harassment"] != "block_only_high" {
+			t.Errorf("Expected safety settings to be sent, got %v", captured["safety"])
+		}
+	})
+}
+
+func TestStreamCollect(t *testing.T) {
+	t.Run("matches non-streaming response", func(t *testing.T) {
+		expected := SendResponse{
+			ID:      "test-id",
+			Object:  "chat.completion",
+			Created: 1234567890,
+			Model:   "gpt-4",
+			Choices: []Choice{
+				{
+					Index: 0,
+					Message: &Message{
+						Role:    "assistant",
+						Content: "Let me check.",
+						ToolCalls: []ToolCall{
+							{ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`}},
+							{ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: `{}`}},
+						},
+					},
+					FinishReason: stringPtr("tool_calls"),
+				},
+			},
+			Usage: &Usage{PromptTokens: 12, CompletionTokens: 8, TotalTokens: 20},
+		}
+
+		mockChunks := []string{
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Let me"},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":" check."},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"location\":"}}]},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":null}]}`,
+			`{"id":"test-id","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":12,"completion_tokens":8,"total_tokens":20}}`,
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if !req.Stream {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(expected)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range mockChunks {
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		sent, err := client.Send("gpt-4", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		collected, err := StreamCollect(client.Stream("gpt-4", "Hello"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !reflect.DeepEqual(sent, collected) {
+			sentJSON, _ := json.Marshal(sent)
+			collectedJSON, _ := json.Marshal(collected)
+			t.Errorf("Expected collected response to match sent response:\nsent:      %s\ncollected: %s", sentJSON, collectedJSON)
+		}
+		if collected.FinishReason() != "tool_calls" {
+			t.Errorf("Expected finish_reason 'tool_calls', got %s", collected.FinishReason())
+		}
+	})
+
+	t.Run("separates reasoning from content", func(t *testing.T) {
+		deltas := []string{
+			`{"role":"assistant","reasoning_content":"The user asks"}`,
+			`{"reasoning_content":" for a capital."}`,
+			`{"content":"The capital"}`,
+			`{"reasoning_content":" France -> Paris."}`,
+			`{"content":" is Paris."}`,
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, delta := range deltas {
+				fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"deepseek-reasoner","choices":[{"index":0,"delta":%s,"finish_reason":null}]}`+"\n\n", delta)
+			}
+			fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"deepseek-reasoner","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		response, err := StreamCollect(client.Stream("deepseek-reasoner", "What is the capital of France?"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if response.Text() != "The capital is Paris." {
+			t.Errorf("Expected content 'The capital is Paris.', got %q", response.Text())
+		}
+		if response.Reasoning() != "The user asks for a capital. France -> Paris." {
+			t.Errorf("Expected separate reasoning, got %q", response.Reasoning())
+		}
+	})
+
+	t.Run("with StreamFallback", func(t *testing.T) {
+		expected := SendResponse{
+			ID:      "test-id",
+			Object:  "chat.completion",
+			Created: 1234567890,
+			Model:   "o1",
+			Choices: []Choice{{
+				Index:        0,
+				Message:      &Message{Role: "assistant", Content: "Full answer"},
+				FinishReason: stringPtr("stop"),
+			}},
+			Usage: &Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if req.Stream {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"This model does not support streaming"}}`))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(expected)
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:         "test-api-key",
+			BaseURL:        server.URL,
+			StreamFallback: true,
+		})
+
+		sent, err := client.Send("o1", "Hello")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		collected, err := StreamCollect(client.Stream("o1", "Hello"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if collected.Usage == nil || *collected.Usage != *expected.Usage {
+			t.Errorf("Expected usage %+v, got %+v", *expected.Usage, collected.Usage)
+		}
+		if !reflect.DeepEqual(sent, collected) {
+			sentJSON, _ := json.Marshal(sent)
+			collectedJSON, _ := json.Marshal(collected)
+			t.Errorf("Expected collected response to match sent response:\nsent:      %s\ncollected: %s", sentJSON, collectedJSON)
+		}
+	})
+
+	t.Run("with out-of-range choice index", func(t *testing.T) {
+		for _, index := range []int{-1, 1000000} {
+			chunks := fmt.Sprintf(`data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":%d,"delta":{"content":"bad"},"finish_reason":null}]}
+
+data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}
+
+data: [DONE]
+
+`, index)
+			response, err := StreamCollect(ReplayStream(strings.NewReader(chunks)))
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("invalid choice index %d", index)) {
+				t.Errorf("Expected invalid choice index error for %d, got %v", index, err)
+			}
+			if len(response.Choices) != 0 {
+				t.Errorf("Expected no choices on error, got %d", len(response.Choices))
+			}
+		}
+	})
+
+	t.Run("with usage-only final chunk", func(t *testing.T) {
+		chunks := `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":"Hello"},"finish_reason":null}]}
+
+data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":1,"total_tokens":10}}
+
+data: [DONE]
+
+`
+		response, err := StreamCollect(ReplayStream(strings.NewReader(chunks)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(response.Choices) != 1 {
+			t.Fatalf("Expected 1 choice, got %d", len(response.Choices))
+		}
+		if response.Text() != "Hello" {
+			t.Errorf("Expected 'Hello', got %q", response.Text())
+		}
+		if response.FinishReason() != "stop" {
+			t.Errorf("Expected finish_reason 'stop', got %s", response.FinishReason())
+		}
+		if response.Usage == nil || *response.Usage != (Usage{PromptTokens: 9, CompletionTokens: 1, TotalTokens: 10}) {
+			t.Errorf("Expected usage from the final chunk, got %+v", response.Usage)
+		}
+	})
+
+	t.Run("with streaming error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		_, err := StreamCollect(client.Stream("gpt-4", "Hello"))
+		if err == nil || !strings.Contains(err.Error(), "API error 500") {
+			t.Errorf("Expected API error 500, got %v", err)
+		}
+	})
+}
+
+func TestMergeToolCallDeltas(t *testing.T) {
+	delta := func(index *int, id, name, arguments string) []ToolCall {
+		call := ToolCall{ID: id, Function: FunctionCall{Name: name, Arguments: arguments}, Index: index}
+		if id != "" {
+			call.Type = "function"
+		}
+		return []ToolCall{call}
+	}
+	intPtr := func(i int) *int { return &i }
+
+	t.Run("interleaved deltas", func(t *testing.T) {
+		var calls []ToolCall
+		calls = MergeToolCallDeltas(calls, delta(intPtr(0), "call_a", "get_weather", ""))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(1), "call_b", "get_time", `{"tz":`))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(0), "", "", `{"city":`))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(1), "", "", `"UTC"}`))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(0), "", "", `"Paris"}`))
+
+		if len(calls) != 2 {
+			t.Fatalf("Expected 2 tool calls, got %d", len(calls))
+		}
+		if calls[0].ID != "call_a" || calls[0].Function.Name != "get_weather" || calls[0].Function.Arguments != `{"city":"Paris"}` {
+			t.Errorf("Unexpected first tool call: %+v", calls[0])
+		}
+		if calls[1].ID != "call_b" || calls[1].Function.Name != "get_time" || calls[1].Function.Arguments != `{"tz":"UTC"}` {
+			t.Errorf("Unexpected second tool call: %+v", calls[1])
+		}
+	})
+
+	t.Run("out-of-order indexes", func(t *testing.T) {
+		var calls []ToolCall
+		calls = MergeToolCallDeltas(calls, delta(intPtr(2), "call_c", "c", "{}"))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(0), "call_a", "a", "{}"))
+		calls = MergeToolCallDeltas(calls, delta(intPtr(1), "call_b", "b", "{}"))
+
+		ids := []string{}
+		for _, call := range calls {
+			ids = append(ids, call.ID)
+		}
+		if strings.Join(ids, ",") != "call_a,call_b,call_c" {
+			t.Errorf("Expected tool calls ordered by index, got %v", ids)
+		}
+	})
+
+	t.Run("missing id and index", func(t *testing.T) {
+		var calls []ToolCall
+		calls = MergeToolCallDeltas(calls, delta(nil, "call_a", "lookup", `{"q":`))
+		calls = MergeToolCallDeltas(calls, delta(nil, "", "", `"go"}`))
+		calls = MergeToolCallDeltas(calls, delta(nil, "call_b", "lookup", `{}`))
+		calls = MergeToolCallDeltas(calls, delta(nil, "call_a", "", ""))
+
+		if len(calls) != 2 {
+			t.Fatalf("Expected 2 tool calls, got %d", len(calls))
+		}
+		if calls[0].ID != "call_a" || calls[0].Function.Arguments != `{"q":"go"}` {
+			t.Errorf("Unexpected first tool call: %+v", calls[0])
+		}
+		if calls[1].ID != "call_b" || calls[1].Function.Arguments != `{}` {
+			t.Errorf("Unexpected second tool call: %+v", calls[1])
+		}
+	})
+
+	t.Run("does not alias delta indexes", func(t *testing.T) {
+		index := 0
+		calls := MergeToolCallDeltas(nil, delta(&index, "call_a", "a", ""))
+		index = 5
+		if *calls[0].Index != 0 {
+			t.Errorf("Expected stored index 0, got %d", *calls[0].Index)
+		}
+	})
+}
+
+func TestRequest_Extra(t *testing.T) {
+	var captured map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured = nil
+		if err := json.Unmarshal(body, &captured); err != nil {
+			t.Errorf("Failed to unmarshal request: %v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	t.Run("merges at the top level", func(t *testing.T) {
+		input := InputObject{
+			Messages: []Message{{Role: "user", Content: "Hello"}},
+			Extra: map[string]any{
+				"min_p":              0.05,
+				"top_a":              0.2,
+				"repetition_penalty": 1.1,
+			},
+		}
+		if _, err := client.Send("openrouter/model", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["min_p"] != 0.05 || captured["top_a"] != 0.2 || captured["repetition_penalty"] != 1.1 {
+			t.Errorf("Expected extra params at top level, got %v", captured)
+		}
+		if captured["model"] != "openrouter/model" {
+			t.Errorf("Expected model to be kept, got %v", captured["model"])
+		}
+		if _, ok := captured["extra"]; ok {
+			t.Error("Expected no nested extra key")
+		}
+	})
+
+	t.Run("preserves nested structure", func(t *testing.T) {
+		input := InputObject{
+			Messages: []Message{{Role: "user", Content: "Hello"}},
+			Extra: map[string]any{
+				"provider": map[string]any{
+					"order":           []string{"anthropic", "openai"},
+					"allow_fallbacks": false,
+				},
+			},
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		provider, ok := captured["provider"].(map[string]any)
+		if !ok {
+			t.Fatalf("Expected nested provider object, got %v", captured["provider"])
+		}
+		order, ok := provider["order"].([]any)
+		if !ok || len(order) != 2 || order[0] != "anthropic" || provider["allow_fallbacks"] != false {
+			t.Errorf("Expected nested structure to be preserved, got %v", provider)
+		}
+	})
+
+	t.Run("typed fields win on collision", func(t *testing.T) {
+		input := InputObject{
+			Messages:    []Message{{Role: "user", Content: "Hello"}},
+			Temperature: float64Ptr(0.3),
+			Extra: map[string]any{
+				"model":       "other-model",
+				"temperature": 1.5,
+				"messages":    []any{},
+			},
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["model"] != "gpt-4" {
+			t.Errorf("Expected typed model to win, got %v", captured["model"])
+		}
+		if captured["temperature"] != 0.3 {
+			t.Errorf("Expected typed temperature to win, got %v", captured["temperature"])
+		}
+		if messages, ok := captured["messages"].([]any); !ok || len(messages) != 1 {
+			t.Errorf("Expected typed messages to win, got %v", captured["messages"])
+		}
+	})
+
+	t.Run("fills unset typed fields", func(t *testing.T) {
+		input := InputObject{
+			Messages: []Message{{Role: "user", Content: "Hello"}},
+			Extra:    map[string]any{"temperature": 0.9},
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if captured["temperature"] != 0.9 {
+			t.Errorf("Expected extra temperature when unset, got %v", captured["temperature"])
+		}
+	})
+}
+
+func TestWithStopPredicate(t *testing.T) {
+	t.Run("stops a stream", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, text := range []string{"The code", " is", " SECRET", "-42"} {
+				fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":%q},"finish_reason":null}]}`+"\n\n", text)
+			}
+			w.(http.Flusher).Flush()
+
+			// Keep the stream open until the client disconnects
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		start := time.Now()
+		chunkChan, errChan := client.Stream("gpt-4", "Hello", WithStopPredicate(func(accumulated string) bool {
+			return strings.Contains(accumulated, "SECRET")
+		}))
+
+		var text strings.Builder
+		for chunk := range chunkChan {
+			text.WriteString(chunk.Text())
+		}
+		err := <-errChan
+
+		if !errors.Is(err, ErrStoppedByPredicate) {
+			t.Fatalf("Expected ErrStoppedByPredicate, got %v", err)
+		}
+		if text.String() != "The code is" {
+			t.Errorf("Expected text before the tripping chunk, got %q", text.String())
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected stream to stop promptly, took %v", elapsed)
+		}
+	})
+
+	t.Run("with StreamFallback", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req Request
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &req)
+
+			if req.Stream {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"message":"This model does not support streaming"}}`))
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(SendResponse{
+				ID:    "test-id",
+				Model: "o1",
+				Choices: []Choice{{
+					Message:      &Message{Role: "assistant", Content: "The code is SECRET-42"},
+					FinishReason: stringPtr("stop"),
+				}},
+			})
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:         "test-api-key",
+			BaseURL:        server.URL,
+			StreamFallback: true,
+		})
+
+		chunkChan, errChan := client.Stream("o1", "Hello", WithStopPredicate(func(accumulated string) bool {
+			return strings.Contains(accumulated, "SECRET")
+		}))
+
+		var text strings.Builder
+		for chunk := range chunkChan {
+			text.WriteString(chunk.Text())
+		}
+		if err := <-errChan; !errors.Is(err, ErrStoppedByPredicate) {
+			t.Fatalf("Expected ErrStoppedByPredicate, got %v", err)
+		}
+		if text.Len() != 0 {
+			t.Errorf("Expected the fallback chunk to be dropped, got %q", text.String())
+		}
+	})
+}
+
+func TestInputObjectFromMaps(t *testing.T) {
+	t.Run("converts mixed messages", func(t *testing.T) {
+		input, err := InputObjectFromMaps([]map[string]any{
+			{"role": "system", "content": "You are a helpful assistant."},
+			{"role": "user", "content": "What is the weather in Paris?", "name": "alice"},
+			{"role": "assistant", "content": nil, "tool_calls": []map[string]any{
+				{"id": "call_1", "type": "function", "function": map[string]any{"name": "get_weather", "arguments": `{"location":"Paris"}`}},
+			}},
+			{"role": "tool", "tool_call_id": "call_1", "content": `{"temperature":18}`},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(input.Messages) != 4 {
+			t.Fatalf("Expected 4 messages, got %d", len(input.Messages))
+		}
+		if input.Messages[0].Role != "system" || input.Messages[0].Content != "You are a helpful assistant." {
+			t.Errorf("Unexpected system message: %+v", input.Messages[0])
+		}
+		if input.Messages[1].Name == nil || *input.Messages[1].Name != "alice" {
+			t.Errorf("Expected name 'alice', got %v", input.Messages[1].Name)
+		}
+		toolCalls := input.Messages[2].ToolCalls
+		if len(toolCalls) != 1 || toolCalls[0].ID != "call_1" || toolCalls[0].Function.Name != "get_weather" || toolCalls[0].Function.Arguments != `{"location":"Paris"}` {
+			t.Errorf("Unexpected tool calls: %+v", toolCalls)
+		}
+		if input.Messages[2].Content != "" {
+			t.Errorf("Expected empty assistant content, got %q", input.Messages[2].Content)
+		}
+		if input.Messages[3].ToolCallID == nil || *input.Messages[3].ToolCallID != "call_1" {
+			t.Errorf("Expected tool_call_id 'call_1', got %v", input.Messages[3].ToolCallID)
+		}
+	})
+
+	invalid := []struct {
+		name     string
+		messages []map[string]any
+		expected string
+	}{
+		{"missing role", []map[string]any{{"content": "Hi"}}, "message 0: invalid role"},
+		{"unknown role", []map[string]any{{"role": "robot", "content": "Hi"}}, `invalid role "robot"`},
+		{"non-string content", []map[string]any{{"role": "user", "content": 42}}, "content must be a string"},
+		{"tool without tool_call_id", []map[string]any{{"role": "tool", "content": "{}"}}, "requires tool_call_id"},
+		{"tool_calls on user", []map[string]any{{"role": "user", "tool_calls": []any{map[string]any{"id": "call_1"}}}}, "only allowed on assistant"},
+		{"malformed tool_calls", []map[string]any{{"role": "assistant", "tool_calls": "call_1"}}, "tool_calls"},
+	}
+
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := InputObjectFromMaps(tc.messages)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestSplitStream(t *testing.T) {
+	sse := func(texts ...string) io.Reader {
+		var b strings.Builder
+		for _, text := range texts {
+			content, _ := json.Marshal(text)
+			fmt.Fprintf(&b, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":"gpt-4","choices":[{"index":0,"delta":{"content":%s},"finish_reason":null}]}`+"\n\n", content)
+		}
+		b.WriteString("data: [DONE]\n\n")
+		return strings.NewReader(b.String())
+	}
+
+	collect := func(t *testing.T, unitChan <-chan string, errChan <-chan error) []string {
+		units := []string{}
+		for unit := range unitChan {
+			units = append(units, unit)
+		}
+		if err := <-errChan; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return units
+	}
+
+	t.Run("sentences", func(t *testing.T) {
+		chunkChan, errChan := ReplayStream(sse("Hel", "lo there", ". Pi is 3.", "14! Is it", "? Yes", " indeed"))
+		unitChan, splitErrChan := SplitStream(chunkChan, errChan, SplitSentences)
+		units := collect(t, unitChan, splitErrChan)
+
+		expected := []string{"Hello there.", "Pi is 3.14!", "Is it?", "Yes indeed"}
+		if !reflect.DeepEqual(units, expected) {
+			t.Errorf("Expected %q, got %q", expected, units)
+		}
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		chunkChan, errChan := ReplayStream(sse("first li", "ne\nsecond\n", "\nthi", "rd"))
+		unitChan, splitErrChan := SplitStream(chunkChan, errChan, SplitLines)
+		units := collect(t, unitChan, splitErrChan)
+
+		expected := []string{"first line", "second", "", "third"}
+		if !reflect.DeepEqual(units, expected) {
+			t.Errorf("Expected %q, got %q", expected, units)
+		}
+	})
+
+	t.Run("forwards stream errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}))
+		defer server.Close()
+
+		client, _ := NewClient(&Config{
+			APIKey:  "test-api-key",
+			BaseURL: server.URL,
+		})
+
+		chunkChan, errChan := client.Stream("gpt-4", "Hello")
+		unitChan, splitErrChan := SplitStream(chunkChan, errChan, SplitSentences)
+		for range unitChan {
+		}
+		if err := <-splitErrChan; err == nil || !strings.Contains(err.Error(), "API error 500") {
+			t.Errorf("Expected API error 500, got %v", err)
+		}
+	})
+}
+
+func TestUsageTracker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":%q,"choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":"stop"}]}`+"\n\n", req.Model)
+			fmt.Fprintf(w, `data: {"id":"test","object":"chat.completion.chunk","created":1234567890,"model":%q,"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`+"\n\n", req.Model)
+			fmt.Fprintf(w, "data: [DONE]\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendResponse{
+			Model: req.Model,
+			Usage: &Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	defer server.Close()
+
+	tracker := &UsageTracker{}
+	client, _ := NewClient(&Config{
+		APIKey:       "test-api-key",
+		BaseURL:      server.URL,
+		UsageTracker: tracker,
+	})
+
+	const calls = 10
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Send("gpt-4", "Hello"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := StreamCollect(client.Stream("mistral/mistral-small-latest", "Hello")); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	expectedTotal := Usage{PromptTokens: 130, CompletionTokens: 60, TotalTokens: 190}
+	if total := tracker.Total(); total != expectedTotal {
+		t.Errorf("Expected total %+v, got %+v", expectedTotal, total)
+	}
+	if tracker.Requests() != 2*calls {
+		t.Errorf("Expected %d requests, got %d", 2*calls, tracker.Requests())
+	}
+
+	byModel := tracker.ByModel()
+	if byModel["gpt-4"] != (Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}) {
+		t.Errorf("Unexpected gpt-4 usage: %+v", byModel["gpt-4"])
+	}
+	if byModel["mistral/mistral-small-latest"] != (Usage{PromptTokens: 30, CompletionTokens: 10, TotalTokens: 40}) {
+		t.Errorf("Unexpected mistral usage: %+v", byModel["mistral/mistral-small-latest"])
+	}
+}
+
+func TestRequest_UnmarshalJSON(t *testing.T) {
+	var req Request
+	body := `{"model":"openrouter/model","messages":[{"role":"user","content":"Hello"}],"temperature":0.7,"min_p":0.05,"provider":{"order":["a","b"]}}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if req.Model != "openrouter/model" || len(req.Messages) != 1 {
+		t.Errorf("Expected typed fields to be decoded, got %+v", req)
+	}
+	if req.Temperature == nil || *req.Temperature != 0.7 {
+		t.Errorf("Expected temperature 0.7, got %v", req.Temperature)
+	}
+	if len(req.Extra) != 2 || req.Extra["min_p"] != 0.05 || req.Extra["provider"] == nil {
+		t.Errorf("Expected min_p and provider in Extra, got %v", req.Extra)
+	}
+	if _, ok := req.Extra["model"]; ok {
+		t.Error("Expected typed keys to be left out of Extra")
+	}
+}
+
+func TestRequest_OutgoingMessages(t *testing.T) {
+	var captured string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured = string(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(SendResponse{ID: "test-id"})
+	}))
+	defer server.Close()
+
+	client, _ := NewClient(&Config{
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+	})
+
+	t.Run("drops annotations", func(t *testing.T) {
+		var response SendResponse
+		body := `{"choices":[{"index":0,"message":{"role":"assistant","content":"Paris is the capital of France.","annotations":[{"type":"url_citation","url_citation":{"start_index":0,"end_index":31,"url":"https://en.wikipedia.org/wiki/Paris"}}]},"finish_reason":"stop"}]}`
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		input := InputObject{
+			Messages: []Message{
+				{Role: "user", Content: "What is the capital of France?"},
+				*response.MessageContent(),
+				{Role: "user", Content: "And of Spain?"},
+			},
+		}
+		if _, err := client.Send("gpt-4o-search-preview", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if strings.Contains(captured, "annotations") {
+			t.Errorf("Expected annotations to be dropped, got %s", captured)
+		}
+		if !strings.Contains(captured, "Paris is the capital of France.") {
+			t.Errorf("Expected assistant content to be sent, got %s", captured)
+		}
+		if len(input.Messages[1].Annotations) != 1 {
+			t.Error("Expected caller's message to keep its annotations")
+		}
+	})
+
+	t.Run("drops reasoning content", func(t *testing.T) {
+		var response SendResponse
+		body := `{"choices":[{"index":0,"message":{"role":"assistant","content":"9.11 is smaller.","reasoning_content":"Compare the decimals: 0.11 < 0.9."},"finish_reason":"stop"}]}`
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		input := InputObject{
+			Messages: []Message{
+				{Role: "user", Content: "Which is smaller, 9.11 or 9.9?"},
+				*response.MessageContent(),
+				{Role: "user", Content: "Why?"},
+			},
+		}
+		if _, err := client.Send("deepseek-reasoner", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if strings.Contains(captured, "reasoning_content") {
+			t.Errorf("Expected reasoning content to be dropped, got %s", captured)
+		}
+		if !strings.Contains(captured, "9.11 is smaller.") {
+			t.Errorf("Expected assistant content to be sent, got %s", captured)
+		}
+		if input.Messages[1].ReasoningContent == "" {
+			t.Error("Expected caller's message to keep its reasoning content")
+		}
+	})
+
+	t.Run("drops streaming tool call indexes", func(t *testing.T) {
+		index := 0
+		toolCalls := MergeToolCallDeltas(nil, []ToolCall{{
+			ID:       "call_123",
+			Type:     "function",
+			Function: FunctionCall{Name: "get_weather", Arguments: `{"location":"Paris"}`},
+			Index:    &index,
+		}})
+
+		input := InputObject{
+			Messages: []Message{
+				{Role: "user", Content: "What's the weather in Paris?"},
+				{Role: "assistant", ToolCalls: toolCalls},
+				{Role: "tool", Content: "Sunny", ToolCallID: stringPtr("call_123")},
+			},
+		}
+		if _, err := client.Send("gpt-4", input); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if strings.Contains(captured, `"index"`) {
+			t.Errorf("Expected tool call index to be dropped, got %s", captured)
+		}
+		if !strings.Contains(captured, `"id":"call_123"`) {
+			t.Errorf("Expected tool call to be sent, got %s", captured)
+		}
+		if toolCalls[0].Index == nil {
+			t.Error("Expected caller's tool call to keep its index")
+		}
+	})
+}
+
+// Helper function to create string pointer
+func stringPtr(s string) *string {
+	return &s
+}
+
+// Helper function to create float64 pointer
+func float64Ptr(f float64) *float64 {
+	return &f
 }